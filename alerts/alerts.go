@@ -0,0 +1,291 @@
+// Package alerts evaluates threshold rules against the daily Records and
+// reports the ones that fire.
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/abx123/go-covid/model"
+	"github.com/abx123/go-covid/states"
+)
+
+const (
+	ScopeNational = "national"
+	ScopeStates   = "states"
+)
+
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Rule compares one metric of a record against a threshold. The threshold is
+// Value, or when Window is set, the Aggregate of the same metric over the
+// Window days before the record.
+type Rule struct {
+	Name string `json:"name" bson:"name"`
+	// Metric is a dotted JSON path into a Record, or into a State when Scope
+	// is ScopeStates, such as "death.newDeaths" or "derived.capacity.icu".
+	Metric string `json:"metric" bson:"metric"`
+	// Scope is ScopeNational, the default, or ScopeStates to check every
+	// state. State limits ScopeStates to one state, named as anything
+	// states.Normalize accepts.
+	Scope string `json:"scope,omitempty" bson:"scope,omitempty"`
+	State string `json:"state,omitempty" bson:"state,omitempty"`
+	// Op is one of >, >=, < or <=.
+	Op        string  `json:"op" bson:"op"`
+	Value     float64 `json:"value,omitempty" bson:"value,omitempty"`
+	Window    int     `json:"window,omitempty" bson:"window,omitempty"`
+	Aggregate string  `json:"aggregate,omitempty" bson:"aggregate,omitempty"`
+	Severity  string  `json:"severity,omitempty" bson:"severity,omitempty"`
+	// Disabled rules are kept in the config but never evaluated.
+	Disabled bool `json:"disabled,omitempty" bson:"disabled,omitempty"`
+}
+
+// Alert is a rule that fired for a day.
+type Alert struct {
+	Rule      string
+	Severity  string
+	Date      string
+	Where     string
+	Metric    string
+	Value     float64
+	Threshold float64
+	Op        string
+}
+
+func (a Alert) String() string {
+	return fmt.Sprintf("[%s] %s: %s %s is %s, %s %s (%s)", strings.ToUpper(a.Severity), a.Where, a.Date, a.Metric, fmtNum(a.Value), a.Op, fmtNum(a.Threshold), a.Rule)
+}
+
+func fmtNum(f float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", f), "0"), ".")
+}
+
+// DefaultRules are used when no rules are configured.
+var DefaultRules = []Rule{
+	{Name: "icu-utilization", Metric: "derived.capacity.icu", Scope: ScopeStates, Op: ">", Value: 80, Severity: SeverityCritical},
+	{Name: "cases-week-over-week", Metric: "derived.casesWeekOverWeek", Op: ">", Value: 30, Severity: SeverityWarning},
+	{Name: "deaths-30-day-max", Metric: "death.newDeaths", Op: ">", Window: 30, Aggregate: "max", Severity: SeverityWarning},
+}
+
+// Validate reports the first problem with r.
+func (r Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule has no name")
+	}
+	if r.Metric == "" {
+		return fmt.Errorf("rule %s: no metric", r.Name)
+	}
+	if _, ok := ops[r.Op]; !ok {
+		return fmt.Errorf("rule %s: unknown op %q", r.Name, r.Op)
+	}
+	switch r.Scope {
+	case "", ScopeNational, ScopeStates:
+	default:
+		return fmt.Errorf("rule %s: unknown scope %q", r.Name, r.Scope)
+	}
+	if _, ok := states.Normalize(r.State); r.State != "" && !ok {
+		return fmt.Errorf("rule %s: unknown state %q", r.Name, r.State)
+	}
+	if r.Window < 0 {
+		return fmt.Errorf("rule %s: negative window", r.Name)
+	}
+	if _, ok := aggregates[r.Aggregate]; r.Window > 0 && !ok {
+		return fmt.Errorf("rule %s: unknown aggregate %q", r.Name, r.Aggregate)
+	}
+	switch r.Severity {
+	case "", SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		return fmt.Errorf("rule %s: unknown severity %q", r.Name, r.Severity)
+	}
+	return nil
+}
+
+var ops = map[string]func(a, b float64) bool{
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+}
+
+var aggregates = map[string]func([]float64) float64{
+	"":    func(v []float64) float64 { return max(v) },
+	"max": func(v []float64) float64 { return max(v) },
+	"min": func(v []float64) float64 {
+		res := v[0]
+		for _, f := range v {
+			if f < res {
+				res = f
+			}
+		}
+		return res
+	},
+	"avg": func(v []float64) float64 {
+		sum := 0.0
+		for _, f := range v {
+			sum += f
+		}
+		return sum / float64(len(v))
+	},
+}
+
+func max(v []float64) float64 {
+	res := v[0]
+	for _, f := range v {
+		if f > res {
+			res = f
+		}
+	}
+	return res
+}
+
+// Lookback is how many days before the evaluated record rules need.
+func Lookback(rules []Rule) int {
+	res := 0
+	for _, r := range rules {
+		if r.Window > res {
+			res = r.Window
+		}
+	}
+	return res
+}
+
+// Evaluate checks rules against the last record of history, which is
+// ordered oldest first and should reach back Lookback(rules) days. Records
+// are expected to have their metrics derived already. A metric the record
+// does not have, or a windowed rule without any earlier days, does not
+// fire.
+func Evaluate(rules []Rule, history []*model.Record) ([]Alert, error) {
+	if len(history) == 0 {
+		return nil, nil
+	}
+	docs := make([]map[string]interface{}, len(history))
+	for i, r := range history {
+		d, err := generic(r)
+		if err != nil {
+			return nil, err
+		}
+		docs[i] = d
+	}
+	rec := history[len(history)-1]
+	today := docs[len(docs)-1]
+
+	res := []Alert{}
+	for _, r := range rules {
+		if r.Disabled {
+			continue
+		}
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+		if r.Scope != ScopeStates {
+			if a, ok := r.check(rec.Date, "Malaysia", today, docs[:len(docs)-1], nil); ok {
+				res = append(res, a)
+			}
+			continue
+		}
+		only, _ := states.Normalize(r.State)
+		names := make([]string, 0, len(rec.States))
+		for k := range rec.States {
+			if only == "" || only == k {
+				names = append(names, k)
+			}
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			path := []string{"states", k}
+			if a, ok := r.check(rec.Date, k, today, docs[:len(docs)-1], path); ok {
+				res = append(res, a)
+			}
+		}
+	}
+	return res, nil
+}
+
+// check evaluates r against today, looking under prefix in every document.
+func (r Rule) check(date, where string, today map[string]interface{}, before []map[string]interface{}, prefix []string) (Alert, bool) {
+	path := append(append([]string{}, prefix...), strings.Split(r.Metric, ".")...)
+	v, ok := lookup(today, path)
+	if !ok {
+		return Alert{}, false
+	}
+	threshold := r.Value
+	if r.Window > 0 {
+		if len(before) > r.Window {
+			before = before[len(before)-r.Window:]
+		}
+		vals := []float64{}
+		for _, d := range before {
+			if f, ok := lookup(d, path); ok {
+				vals = append(vals, f)
+			}
+		}
+		if len(vals) == 0 {
+			return Alert{}, false
+		}
+		threshold = aggregates[r.Aggregate](vals)
+	}
+	if !ops[r.Op](v, threshold) {
+		return Alert{}, false
+	}
+	sev := r.Severity
+	if sev == "" {
+		sev = SeverityWarning
+	}
+	return Alert{
+		Rule:      r.Name,
+		Severity:  sev,
+		Date:      date,
+		Where:     where,
+		Metric:    r.Metric,
+		Value:     v,
+		Threshold: threshold,
+		Op:        r.Op,
+	}, true
+}
+
+// generic encodes rec the way the API does so rules can name metrics by
+// their JSON paths.
+func generic(rec *model.Record) (map[string]interface{}, error) {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	res := map[string]interface{}{}
+	if err := d.Decode(&res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// lookup returns the number at path. A missing value, such as a derived
+// figure that could not be computed, is reported as not found.
+func lookup(doc map[string]interface{}, path []string) (float64, bool) {
+	cur := doc
+	for i, k := range path {
+		v, ok := cur[k]
+		if !ok {
+			return 0, false
+		}
+		if i == len(path)-1 {
+			n, ok := v.(json.Number)
+			if !ok {
+				return 0, false
+			}
+			f, err := n.Float64()
+			return f, err == nil
+		}
+		if cur, ok = v.(map[string]interface{}); !ok {
+			return 0, false
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,45 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// LoadFile reads a JSON array of rules from path.
+func LoadFile(path string) ([]Rule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules := []Rule{}
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, err
+	}
+	return rules, validate(rules)
+}
+
+// LoadMongo reads every rule document in coll.
+func LoadMongo(ctx context.Context, coll *mongo.Collection) ([]Rule, error) {
+	cursor, err := coll.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	rules := []Rule{}
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, err
+	}
+	return rules, validate(rules)
+}
+
+func validate(rules []Rule) error {
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
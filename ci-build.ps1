@@ -1,6 +1,6 @@
 GOOS=linux 
-go build -o output/crawler ./crawler/main.go
-go build -o output/get ./get/main.go
+go build -o output/crawler ./crawler
+go build -o output/get ./get
 
 zip output/crawler.zip output/crawler
 zip output/get.zip output/get
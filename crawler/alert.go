@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/abx123/go-covid/alerts"
+	"github.com/abx123/go-covid/metrics"
+	"github.com/abx123/go-covid/model"
+	"github.com/abx123/go-covid/notify"
+	"github.com/abx123/go-covid/repository"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var severityColors = map[string]string{
+	alerts.SeverityInfo:     "#439fe0",
+	alerts.SeverityWarning:  "#ecb22e",
+	alerts.SeverityCritical: "#e01e5a",
+}
+
+// loadRules reads the alert rules named by ALERT_RULES: "mongo" for the
+// alertRules collection, otherwise a path to a JSON file. Without it the
+// built-in alerts.DefaultRules apply.
+func loadRules(ctx context.Context, db *mongo.Database) ([]alerts.Rule, error) {
+	switch src := os.Getenv("ALERT_RULES"); src {
+	case "":
+		return alerts.DefaultRules, nil
+	case "mongo":
+		return alerts.LoadMongo(ctx, db.Collection("alertRules"))
+	default:
+		return alerts.LoadFile(src)
+	}
+}
+
+// metricDatasets are the optional datasets behind metrics, keyed by the
+// start of their JSON path on a Record or State. Every metric also depends on
+// the required datasets.
+var metricDatasets = []struct {
+	prefix   string
+	datasets []string
+}{
+	{"derived.capacity.", capacityDatasets},
+	{"hospital.", []string{"epidemic/hospital.csv"}},
+	{"icu.", []string{"epidemic/icu.csv"}},
+	{"pkrc.", []string{"epidemic/pkrc.csv"}},
+	{"derived.positivityRate", []string{"epidemic/tests_malaysia.csv", "epidemic/tests_state.csv"}},
+	{"tests.", []string{"epidemic/tests_malaysia.csv"}},
+	{"test.", []string{"epidemic/tests_state.csv"}},
+	{"derived.casesPer100k", []string{"static/population.csv"}},
+	{"derived.deathsPer100k", []string{"static/population.csv"}},
+	{"population.", []string{"static/population.csv"}},
+	{"vaccination.", []string{"vaccination/vax_malaysia.csv", "vaccination/vax_state.csv"}},
+}
+
+// ruleDatasets returns the datasets the metric of r is built from.
+func ruleDatasets(r alerts.Rule) []string {
+	res := []string{}
+	for name := range requiredDatasets {
+		res = append(res, name)
+	}
+	for _, m := range metricDatasets {
+		if strings.HasPrefix(r.Metric, m.prefix) {
+			res = append(res, m.datasets...)
+		}
+	}
+	return res
+}
+
+// checkAlerts evaluates rules for rec against the stored days before it.
+func checkAlerts(ctx context.Context, repo repository.RecordRepository, rules []alerts.Rule, rec model.Record) ([]alerts.Alert, error) {
+	t, err := time.Parse("2006-01-02", rec.Date)
+	if err != nil {
+		return nil, err
+	}
+	// Load enough before the rule windows for their derived values too.
+	from := t.AddDate(0, 0, -(alerts.Lookback(rules) + metrics.Lookback))
+	prev, err := repo.Range(ctx, from.Format("2006-01-02"), t.AddDate(0, 0, -1).Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	history := append(prev, &rec)
+	metrics.Annotate(history)
+	return alerts.Evaluate(rules, history)
+}
+
+// alertReport is the message for the alerts fired for one day, one
+// attachment per alert coloured by severity.
+func alertReport(as []alerts.Alert) notify.Message {
+	atts := []notify.Attachment{}
+	for _, a := range as {
+		atts = append(atts, notify.Attachment{
+			Color:    severityColors[a.Severity],
+			Title:    fmt.Sprintf("%s %s", flags[a.Where], a.Where),
+			Text:     a.String(),
+			Fallback: a.String(),
+		})
+	}
+	return notify.Message{
+		Text:        fmt.Sprintf(":rotating_light: %d alert(s) for %s", len(as), as[0].Date),
+		Attachments: atts,
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CacheEntry is what a FetchCache remembers about one dataset from the last
+// successful run: the validators to send on the next request and the body
+// to reuse when the server answers 304 Not Modified.
+type CacheEntry struct {
+	Dataset      string    `json:"dataset" bson:"_id"`
+	ETag         string    `json:"etag,omitempty" bson:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty" bson:"lastModified,omitempty"`
+	Hash         string    `json:"hash" bson:"hash"`
+	Body         []byte    `json:"body" bson:"body"`
+	FetchedAt    time.Time `json:"fetchedAt" bson:"fetchedAt"`
+}
+
+// FetchCache stores CacheEntries between runs. Get returns nil, nil for a
+// dataset that has never been cached.
+type FetchCache interface {
+	Get(ctx context.Context, dataset string) (*CacheEntry, error)
+	Put(ctx context.Context, entry CacheEntry) error
+}
+
+// NewFetchCache picks the cache from FETCH_CACHE: "mongo" (the default)
+// stores entries in the fetchCache collection, "disk" under FETCH_CACHE_DIR,
+// and "off" disables conditional fetching.
+func NewFetchCache(client *mongo.Client) FetchCache {
+	switch os.Getenv("FETCH_CACHE") {
+	case "off":
+		return nil
+	case "disk":
+		dir := os.Getenv("FETCH_CACHE_DIR")
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "covid-fetch-cache")
+		}
+		return DiskCache{Dir: dir}
+	}
+	return MongoCache{Col: client.Database("covid").Collection("fetchCache")}
+}
+
+func hashBody(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// maxMongoBody is the largest body MongoCache stores, leaving room under
+// MongoDB's 16 MB document limit for the rest of the entry.
+const maxMongoBody = 15 << 20
+
+// MongoCache keeps one document per dataset. Bodies too large for a document
+// are not cached, so those datasets are always downloaded in full.
+type MongoCache struct {
+	Col *mongo.Collection
+}
+
+func (c MongoCache) Get(ctx context.Context, dataset string) (*CacheEntry, error) {
+	res := &CacheEntry{}
+	err := c.Col.FindOne(ctx, bson.M{"_id": dataset}).Decode(res)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c MongoCache) Put(ctx context.Context, entry CacheEntry) error {
+	if len(entry.Body) > maxMongoBody {
+		// Drop any earlier, smaller copy rather than keep an outdated body.
+		_, err := c.Col.DeleteOne(ctx, bson.M{"_id": entry.Dataset})
+		return err
+	}
+	opt := options.Replace().SetUpsert(true)
+	_, err := c.Col.ReplaceOne(ctx, bson.M{"_id": entry.Dataset}, entry, opt)
+	return err
+}
+
+// DiskCache keeps one JSON file per dataset in Dir.
+type DiskCache struct {
+	Dir string
+}
+
+func (c DiskCache) path(dataset string) string {
+	return filepath.Join(c.Dir, url.PathEscape(dataset)+".json")
+}
+
+func (c DiskCache) Get(ctx context.Context, dataset string) (*CacheEntry, error) {
+	b, err := os.ReadFile(c.path(dataset))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := &CacheEntry{}
+	if err := json.Unmarshal(b, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c DiskCache) Put(ctx context.Context, entry CacheEntry) error {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path(entry.Dataset), b, 0o644)
+}
+
+// stagedCache holds back Puts until Commit, so a run that fails after
+// downloading does not make the next run believe it is up to date. A nil
+// FetchCache behaves as an always-empty cache.
+type stagedCache struct {
+	FetchCache
+	mu      sync.Mutex
+	pending map[string]CacheEntry
+}
+
+func newStagedCache(c FetchCache) *stagedCache {
+	return &stagedCache{FetchCache: c, pending: map[string]CacheEntry{}}
+}
+
+func (c *stagedCache) Get(ctx context.Context, dataset string) (*CacheEntry, error) {
+	if c.FetchCache == nil {
+		return nil, nil
+	}
+	return c.FetchCache.Get(ctx, dataset)
+}
+
+func (c *stagedCache) Put(ctx context.Context, entry CacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[entry.Dataset] = entry
+	return nil
+}
+
+func (c *stagedCache) Commit(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.pending {
+		if c.FetchCache == nil {
+			delete(c.pending, k)
+			continue
+		}
+		if err := c.FetchCache.Put(ctx, e); err != nil {
+			return err
+		}
+		delete(c.pending, k)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/abx123/go-covid/metrics"
+	"github.com/abx123/go-covid/model"
+	"github.com/abx123/go-covid/notify"
+)
+
+// levelColors are the Slack attachment colours for each utilization level.
+var levelColors = map[metrics.Level]string{
+	metrics.LevelOK:       "#2eb67d",
+	metrics.LevelWarn:     "#ecb22e",
+	metrics.LevelCritical: "#e01e5a",
+}
+
+// capacityReport builds the Slack message for the capacity of rec, which
+// must have been through metrics.Annotate: the national roll-up first, then
+// every state from the fullest ICU down. Each attachment is coloured by its
+// most utilized facility.
+func capacityReport(rec model.Record) notify.Message {
+	title := fmt.Sprintf("%s Healthcare capacity as of %s", flags["Malaysia"], rec.Date)
+	atts := []notify.Attachment{capacityAttachment("Malaysia", capacityOf(rec.Derived))}
+
+	names := make([]string, 0, len(rec.States))
+	for k := range rec.States {
+		names = append(names, k)
+	}
+	icu := func(name string) float64 {
+		c := capacityOf(rec.States[name].Derived)
+		if c == nil || c.ICU == nil {
+			return -1
+		}
+		return *c.ICU
+	}
+	sort.Slice(names, func(a, b int) bool {
+		if icu(names[a]) != icu(names[b]) {
+			return icu(names[a]) > icu(names[b])
+		}
+		return names[a] < names[b]
+	})
+	for _, k := range names {
+		atts = append(atts, capacityAttachment(k, capacityOf(rec.States[k].Derived)))
+	}
+	return notify.Message{Text: title, Attachments: atts}
+}
+
+func capacityOf(d *model.Derived) *model.Capacity {
+	if d == nil {
+		return nil
+	}
+	return d.Capacity
+}
+
+func capacityAttachment(name string, c *model.Capacity) notify.Attachment {
+	title := fmt.Sprintf("%s %s", flags[name], name)
+	if c == nil {
+		return notify.Attachment{Color: levelColors[metrics.LevelOK], Title: title, Text: "No facility data", Fallback: name + ": no facility data"}
+	}
+	text := fmt.Sprintf("ICU: %s | ICU (COVID): %s | Ventilators: %s \nBeds: %s | COVID Beds: %s | PKRC: %s",
+		percent(c.ICU), percent(c.ICUCovid), percent(c.Ventilators),
+		percent(c.Beds), percent(c.CovidBeds), percent(c.PKRC))
+	return notify.Attachment{
+		Color:    levelColors[metrics.WorstLevel(c)],
+		Title:    title,
+		Text:     text,
+		Fallback: fmt.Sprintf("%s: ICU %s, ventilators %s, COVID beds %s", name, percent(c.ICU), percent(c.Ventilators), percent(c.CovidBeds)),
+	}
+}
+
+func percent(f *float64) string {
+	if f == nil {
+		return "n/a"
+	}
+	return strconv.FormatFloat(*f, 'f', 1, 64) + "%"
+}
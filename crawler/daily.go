@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abx123/go-covid/metrics"
+	"github.com/abx123/go-covid/model"
+	"github.com/abx123/go-covid/notify"
+)
+
+// dailyReport is the message posted for each new day: a header, the national
+// figures as field pairs, then every state ranked by new cases in a compact
+// table. Changes are against prev, the day before, when it is known. The
+// plain-text version carries the same content for targets without Block
+// Kit.
+func dailyReport(rec model.Record, prev *model.Record) notify.Message {
+	p := model.Record{}
+	if prev != nil {
+		p = *prev
+	}
+	figures := []struct {
+		label     string
+		cur, prev int
+	}{
+		{"New Cases", rec.NewCases, p.NewCases},
+		{"Import Cases", rec.ImportCases, p.ImportCases},
+		{"Active Cases", rec.ActiveCases, p.ActiveCases},
+		{"Recovered Cases", rec.RecoveredCases, p.RecoveredCases},
+		{"New Deaths", rec.Death.NewDeaths, p.Death.NewDeaths},
+		{"Brought in Dead (BID)", rec.Death.BIDDeaths, p.Death.BIDDeaths},
+		{"Actual COVID Deaths", rec.Death.ActualDeaths, p.Death.ActualDeaths},
+	}
+	title := fmt.Sprintf("%s Data as of %s", flags["Malaysia"], rec.Date)
+
+	fields := []string{}
+	text := title + "\n"
+	for _, f := range figures {
+		t := ""
+		if prev != nil {
+			t = " " + trend(f.cur, f.prev)
+		}
+		fields = append(fields, fmt.Sprintf("*%s*\n%s%s", f.label, comma(f.cur), t))
+		text += fmt.Sprintf(" %s: %d%s \n", f.label, f.cur, t)
+	}
+	text += metrics.Text(rec.Derived)
+
+	table := stateTable(rec, prev)
+	text += "\n" + table
+
+	blocks := []notify.Block{notify.Header(fmt.Sprintf("COVID-19 Malaysia, %s", rec.Date))}
+	blocks = append(blocks, notify.Fields(fields...)...)
+	if d := rec.Derived; d != nil {
+		lines := strings.Split(strings.TrimSpace(metrics.Text(d)), "\n")
+		for i := range lines {
+			lines[i] = strings.TrimSpace(lines[i])
+		}
+		blocks = append(blocks, notify.Context(strings.Join(lines, " · ")))
+	}
+	blocks = append(blocks, notify.Divider(), notify.Section("*New cases by state*\n```"+table+"```"))
+	return notify.Message{Text: text, Blocks: blocks}
+}
+
+// stateTable ranks the states by new cases, one line each with the change
+// from prev and the 7-day average.
+func stateTable(rec model.Record, prev *model.Record) string {
+	s := []model.State{}
+	for _, v := range rec.States {
+		s = append(s, v)
+	}
+	sort.Slice(s, func(a, b int) bool {
+		if s[a].NewCases != s[b].NewCases {
+			return s[a].NewCases > s[b].NewCases
+		}
+		return s[a].Name < s[b].Name
+	})
+	sb := strings.Builder{}
+	for i, v := range s {
+		t := ""
+		if prev != nil {
+			if pv, ok := prev.States[v.Name]; ok {
+				t = trend(v.NewCases, pv.NewCases)
+			}
+		}
+		avg := ""
+		if v.Derived != nil && v.Derived.NewCasesAvg7 != nil {
+			avg = "avg " + comma(int(*v.Derived.NewCasesAvg7+0.5))
+		}
+		line := fmt.Sprintf("%2d. %-18s %7s %-9s %s", i+1, v.Name, comma(v.NewCases), t, avg)
+		sb.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return sb.String()
+}
+
+// trend is an arrow and the change from prev to cur.
+func trend(cur, prev int) string {
+	switch d := cur - prev; {
+	case d > 0:
+		return "▲ " + comma(d)
+	case d < 0:
+		return "▼ " + comma(-d)
+	}
+	return "▬ 0"
+}
+
+// comma formats n with thousands separators.
+func comma(n int) string {
+	s := strconv.Itoa(n)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	if neg {
+		return "-" + s
+	}
+	return s
+}
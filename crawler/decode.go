@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// decodeCSV maps data onto out, which must be a pointer to a slice of
+// structs. The first row is the header; every other row becomes one element.
+// Fields are matched to columns through their `csv` tag, e.g.
+// `csv:"cases_new"`. A tagged column missing from the header is an error
+// unless the tag carries the optional flag (`csv:"cases_boost,optional"`);
+// columns without a matching field are ignored. Rows that fail to parse are
+// skipped and returned as rejections; the error is reserved for problems that
+// invalidate the whole dataset.
+func decodeCSV(data [][]string, out interface{}) ([]RowError, error) {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice || rv.Elem().Type().Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("decodeCSV: want pointer to slice of structs, got %T", out)
+	}
+	if len(data) == 0 {
+		return nil, errors.New("missing header row")
+	}
+	slice := rv.Elem()
+	typ := slice.Type().Elem()
+	cols, err := mapColumns(data[0], typ)
+	if err != nil {
+		return nil, err
+	}
+	rejected := []RowError{}
+	for i, row := range data[1:] {
+		elem := reflect.New(typ).Elem()
+		err := decodeRow(row, cols, elem)
+		if err == nil && len(row) != len(data[0]) {
+			// A short or long row may have its values under the wrong columns.
+			err = fmt.Errorf("row has %d fields, header has %d", len(row), len(data[0]))
+		}
+		if err != nil {
+			// +2: the header is line 1 and lines are 1-based.
+			rejected = append(rejected, RowError{Line: i + 2, Error: err.Error()})
+			continue
+		}
+		slice = reflect.Append(slice, elem)
+	}
+	rv.Elem().Set(slice)
+	return rejected, nil
+}
+
+type column struct {
+	name  string
+	index int
+	field int
+}
+
+func mapColumns(header []string, typ reflect.Type) ([]column, error) {
+	index := map[string]int{}
+	for i, h := range header {
+		index[strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))] = i
+	}
+	cols := []column{}
+	missing := []string{}
+	for i := 0; i < typ.NumField(); i++ {
+		tag := typ.Field(i).Tag.Get("csv")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		optional := len(parts) > 1 && parts[1] == "optional"
+		idx, ok := index[name]
+		if !ok {
+			if !optional {
+				missing = append(missing, name)
+			}
+			continue
+		}
+		cols = append(cols, column{name: name, index: idx, field: i})
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required columns: %s", strings.Join(missing, ", "))
+	}
+	return cols, nil
+}
+
+func decodeRow(row []string, cols []column, elem reflect.Value) error {
+	for _, c := range cols {
+		if c.index >= len(row) {
+			return fmt.Errorf("column %q: row has only %d fields", c.name, len(row))
+		}
+		val := strings.TrimSpace(row[c.index])
+		f := elem.Field(c.field)
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(val)
+		case reflect.Int:
+			if val == "" {
+				continue
+			}
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return fmt.Errorf("column %q: %w", c.name, err)
+			}
+			f.SetInt(int64(n))
+		case reflect.Float64:
+			if val == "" {
+				continue
+			}
+			n, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return fmt.Errorf("column %q: %w", c.name, err)
+			}
+			f.SetFloat(n)
+		default:
+			return fmt.Errorf("column %q: unsupported field kind %s", c.name, f.Kind())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testRow struct {
+	Date  string  `csv:"date"`
+	Cases int     `csv:"cases_new"`
+	Rate  float64 `csv:"rate,optional"`
+}
+
+func TestDecodeCSV(t *testing.T) {
+	data, err := readCSV(strings.NewReader("\ufeffdate,cases_new,extra\n" +
+		"2021-09-01,5,x\n" +
+		"2021-09-02\n" +
+		"2021-09-03,1,x,y\n" +
+		"2021-09-04,abc,x\n" +
+		"2021-09-05,,x\n"))
+	if err != nil {
+		t.Fatalf("readCSV: %v", err)
+	}
+	rows := []testRow{}
+	rejected, err := decodeCSV(data, &rows)
+	if err != nil {
+		t.Fatalf("decodeCSV: %v", err)
+	}
+	want := []testRow{{Date: "2021-09-01", Cases: 5}, {Date: "2021-09-05"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows %+v, want %+v", rows, want)
+	}
+	lines := []int{}
+	for _, r := range rejected {
+		lines = append(lines, r.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{3, 4, 5}) {
+		t.Errorf("rejected %+v, want lines 3, 4 and 5", rejected)
+	}
+}
+
+func TestDecodeCSVMissingColumn(t *testing.T) {
+	rows := []testRow{}
+	_, err := decodeCSV([][]string{{"date", "rate"}}, &rows)
+	if err == nil || !strings.Contains(err.Error(), "cases_new") {
+		t.Errorf("err = %v, want missing cases_new", err)
+	}
+	if _, err := decodeCSV(nil, &rows); err == nil {
+		t.Error("no error without a header row")
+	}
+	if _, err := decodeCSV([][]string{{"date"}}, rows); err == nil {
+		t.Error("no error for a non-pointer")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+)
+
+const defaultFetchWorkers = 4
+
+// datasets lists every file get reads so they can be downloaded up front.
+var datasets = []string{
+	"epidemic/cases_malaysia.csv",
+	"epidemic/cases_state.csv",
+	"epidemic/deaths_malaysia.csv",
+	"epidemic/deaths_state.csv",
+	"epidemic/hospital.csv",
+	"epidemic/icu.csv",
+	"epidemic/pkrc.csv",
+	"epidemic/tests_malaysia.csv",
+	"epidemic/tests_state.csv",
+	"static/population.csv",
+	"vaccination/vax_malaysia.csv",
+	"vaccination/vax_state.csv",
+}
+
+// fetchWorkers is the number of datasets downloaded in parallel, read from
+// FETCH_WORKERS.
+func fetchWorkers() int {
+	if n, err := strconv.Atoi(os.Getenv("FETCH_WORKERS")); err == nil && n > 0 {
+		return n
+	}
+	return defaultFetchWorkers
+}
+
+type fetchResult struct {
+	ds  Dataset
+	err error
+}
+
+// prefetchedSource serves the results of fetchAll, falling through to the
+// underlying source for anything that was not prefetched.
+type prefetchedSource struct {
+	src     Source
+	results map[string]fetchResult
+}
+
+func (s prefetchedSource) Fetch(ctx context.Context, dataset string) (Dataset, error) {
+	if r, ok := s.results[dataset]; ok {
+		return r.ds, r.err
+	}
+	return s.src.Fetch(ctx, dataset)
+}
+
+// fetchAll downloads names from src with at most workers requests in
+// flight. A failed dataset does not stop the others; its error is returned
+// when the dataset is read from the result.
+func fetchAll(ctx context.Context, src Source, names []string, workers int) prefetchedSource {
+	res := prefetchedSource{src: src, results: map[string]fetchResult{}}
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	sem := make(chan struct{}, workers)
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			ds, err := src.Fetch(ctx, name)
+			mu.Lock()
+			res.results[name] = fetchResult{ds: ds, err: err}
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+	return res
+}
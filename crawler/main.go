@@ -1,210 +1,160 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/csv"
-	"encoding/json"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
 
+	"github.com/abx123/go-covid/metrics"
+	"github.com/abx123/go-covid/model"
+	"github.com/abx123/go-covid/repository"
+
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type Record struct {
-	ID                primitive.ObjectID `bson:"_id,omitempty"`
-	Date              string             `bson:"date,omitempty"`
-	NewCases          int                `bson:"newCases,omitempty"`
-	ImportCases       int                `bson:"importCases,omitempty"`
-	RecoveredCases    int                `bson:"recoveredCases,omitempty"`
-	ActiveCases       int                `bson:"activeCases,omitempty"`
-	ClusterCases      int                `bson:"clusterCases,omitempty"`
-	PVax              int                `bson:"partiallyVaccinatedCases,omitempty"`
-	FVax              int                `bson:"fullyVaccinatedCases,omitempty"`
-	ChildCases        int                `bson:"childCases,omitempty"`
-	AdolescentCases   int                `bson:"adolescentCases,omitempty"`
-	AdultCases        int                `bson:"adultCases,omitempty"`
-	ElderlyCases      int                `bson:"elderlyCases,omitempty"`
-	ClusterImport     int                `bson:"importClusters,omitempty"`
-	ClusterReligious  int                `bson:"religiousClusters,omitempty"`
-	ClusterCommunity  int                `bson:"communityClusters,omitempty"`
-	ClusterHighRisk   int                `bson:"HighRiskClusters,omitempty"`
-	ClusterEducation  int                `bson:"educationClusters,omitempty"`
-	ClusterDentention int                `bson:"detentionClusters,omitempty"`
-	ClusterWorkplace  int                `bson:"workspaceClusters,omitempty"`
-	States            map[string]State   `bson:"states,omitempty"`
-	Death             Death              `bson:"death,omitempty"`
-	Test              Test               `bson:"tests,omitempty"`
-	Population        Population         `bson:"population,omitempty"`
-}
-
-type Population struct {
-	Population int `bson:"population,omitempty"`
-	Over18     int `bson:"over18,omitempty"`
-	Over60     int `bson:"over60,omitempty"`
-	Over12     int `bson:"over12,omitempty"`
-}
-
-type Test struct {
-	RtkAg int `bson:"rtkAg,omitempty"`
-	Pcr   int `bson:"Pcr,omitempty"`
-}
-
-type State struct {
-	Name            string     `bson:"Name,omitempty"`
-	ImportCases     int        `bson:"importCases,omitempty"`
-	NewCases        int        `bson:"newCases,omitempty"`
-	RecoveredCases  int        `bson:"recoveredCases,omitempty"`
-	ActiveCases     int        `bson:"activeCases,omitempty"`
-	ClusterCases    int        `bson:"clusterCases,omitempty"`
-	PVax            int        `bson:"partiallyVaccinatedCases,omitempty"`
-	FVax            int        `bson:"fullyVaccinatedCases,omitempty"`
-	ChildCases      int        `bson:"childCases,omitempty"`
-	AdolescentCases int        `bson:"adolescentCases,omitempty"`
-	AdultCases      int        `bson:"adultCases,omitempty"`
-	ElderlyCases    int        `bson:"elderlyCases,omitempty"`
-	Death           Death      `bson:"death,omitempty"`
-	Hospital        Hospital   `bson:"hospital,omitempty"`
-	ICU             ICU        `bson:"icu,omitempty"`
-	PKRC            PKRC       `bson:"pkrc,omitempty"`
-	Test            Test       `bson:"test,omitempty"`
-	Population      Population `bson:"population,omitempty"`
-}
-
-type Hospital struct {
-	Beds                 int `bson:"beds,omitempty"`
-	CovidBeds            int `bson:"covidBeds,omitempty"`
-	NonCriticalBeds      int `bson:"nonCriticalBeds,omitempty"`
-	AdmittedPUI          int `bson:"admittedPui,omitempty"`
-	AdmittedCovid        int `bson:"admittedCovid,omitempty"`
-	AdmittedTotal        int `bson:"admittedTotal,omitempty"`
-	DischargedPui        int `bson:"dischargedPui,omitempty"`
-	DischargedCovid      int `bson:"dischargedCovid,omitempty"`
-	DischargedTotal      int `bson:"dischargedTotal,omitempty"`
-	HospitalizedCovid    int `bson:"hospitalizedCovid,omitempty"`
-	HospitalizedPui      int `bson:"hospitalizedPui,omitempty"`
-	HospitalizedNonCovid int `bson:"hospitalizedNonCovid,omitempty"`
-}
+// func main() {
+// 	crawl(context.Background(), events.APIGatewayProxyRequest{})
+// }
 
-type Death struct {
-	NewDeaths       int `bson:"newDeaths,omitempty"`
-	ActualDeaths    int `bson:"actualDeaths,omitempty"`
-	BIDDeaths       int `bson:"bidDeaths,omitempty"`
-	ActualBIDDeaths int `bson:"actualBidDeaths,omitempty"`
-	PVaxDeaths      int `bson:"partiallyVaccinatedDeaths,omitempty"`
-	FVaxDeaths      int `bson:"FullyVaccinatedDeaths,omitempty"`
+func main() {
+	lambda.Start(crawl)
 }
 
-type ICU struct {
-	ICUBeds             int `bson:"icuBeds,omitempty"`
-	ICUBedsRep          int `bson:"iceBedsRep,omitempty"`
-	ICUBedsTotal        int `bson:"icuBedsTotal,omitempty"`
-	ICUBedsCovid        int `bson:"icuBedsCovid,omitempty"`
-	Ventilators         int `bson:"ventilators,omitempty"`
-	PortableVentilators int `bson:"portableVentilators,omitempty"`
-	ICUCovid            int `bson:"icuCovid,omitempty"`
-	ICUPui              int `bson:"icuPui,omitempty"`
-	ICUNonCovid         int `bson:"icuNonCovid,omitempty"`
-	VentCovid           int `bson:"ventilatorsCovid,omitempty"`
-	VentPui             int `bson:"ventilatorsPui,omitempty"`
-	VentNonCovid        int `bson:"ventilatorsNonCovid,omitempty"`
-	VentUsed            int `bson:"ventilatorsUsed,omitempty"`
-	PortVentUsed        int `bson:"portableVentilatorsUsed,omitempty"`
-}
+func crawl(ctx context.Context) (*Report, error) {
+	client, err := NewMongoClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Disconnect(context.Background())
+	repo := repository.NewMongo(client.Database("covid"))
+	if err := repo.EnsureIndexes(ctx); err != nil {
+		return nil, err
+	}
 
-type PKRC struct {
-	Beds            int `bson:"beds,omitempty"`
-	AdmittedCovid   int `bson:"admittedCovid,omitempty"`
-	AdmittedPui     int `bson:"admittedPui,omitempty"`
-	AdmittedTotal   int `bson:"admittedTotal,omitempty"`
-	DischargedPui   int `bson:"dischargedPui,omitempty"`
-	DischargedCovid int `bson:"dischargedCovid,omitempty"`
-	DischargedTotal int `bson:"dischargedTotal,omitempty"`
-	PKRCCovid       int `bson:"pkrcCovid,omitempty"`
-	PKRCPui         int `bson:"pkrcPui,omitempty"`
-	PKRCNonCovid    int `bson:"pkrcNonCovid,omitempty"`
-}
+	// initMongoRecord(repo)
+	// truncateMongo(client.Database("covid").Collection("my"))
 
-func getLatestFromMongo(collection *mongo.Collection) (*Record, error) {
-	res := &Record{}
-	opt := options.FindOne()
-	opt.SetSort(bson.M{"date": -1})
-	err := collection.FindOne(context.TODO(), bson.M{}, opt).Decode(res)
+	pub, err := newPublisher(ctx, client.Database("covid"))
 	if err != nil {
 		return nil, err
 	}
-	return res, nil
-}
 
-func getAllFromMongo(collection *mongo.Collection) ([]*Record, error) {
-	res := []*Record{}
-	opt := options.Find()
-	opt.SetSort(bson.M{"date": -1})
-	cursor, err := collection.Find(context.TODO(), bson.M{}, opt)
+	cache := newStagedCache(NewFetchCache(client))
+	rep, err := ingest(ctx, repo, NewSource(cache), pub)
 	if err != nil {
-		return nil, err
+		return rep, err
 	}
-	for cursor.Next(context.TODO()) {
-		rec := &Record{}
-		err := cursor.Decode(&rec)
-		if err != nil {
-			return nil, err
-		}
-		res = append(res, rec)
+	// Only remember what was fetched once it is safely stored, otherwise the
+	// next run would see 304s and skip the days that failed.
+	if err := cache.Commit(ctx); err != nil {
+		return rep, err
 	}
-	return res, nil
+	return rep, nil
 }
 
-// func main() {
-// 	crawl(context.Background(), events.APIGatewayProxyRequest{})
-// }
-
-func main() {
-	lambda.Start(crawl)
-}
-
-func crawl() {
-	client, _ := NewMongoClient()
-	defer client.Disconnect(context.Background())
-	collection := client.Database("covid").Collection("my")
-
-	// initMongoRecord(collection)
-	// truncateMongo(collection)
-
-	new := get()
-	latest, err := getLatestFromMongo(collection)
+// ingest crawls src and stores every new day, plus any day within the
+// revision window that MoH has since revised. Stored days are only revised
+// when every dataset loaded. New days are posted to Slack and checked
+// against the alert rules.
+func ingest(ctx context.Context, repo repository.RecordRepository, src Source, pub *publisher) (*Report, error) {
+	new, rep := get(ctx, src)
+	log.Print(rep)
+	if failed := rep.Failed(); len(failed) > 0 {
+		return rep, fmt.Errorf("required datasets failed: %s", strings.Join(failed, ", "))
+	}
+	if len(rep.Changed()) == 0 {
+		log.Println("no dataset changed since the last run, skipping")
+		return rep, nil
+	}
+	latest, err := repo.Latest(ctx)
 	if err != nil {
-		log.Println(err.Error())
+		return rep, err
+	}
+	t, err := time.Parse("2006-01-02", latest.Date)
+	if err != nil {
+		return rep, err
+	}
+	// Re-compare the trailing window as well as the new days, since MoH
+	// regularly revises recent deaths and BID figures.
+	start := t.AddDate(0, 0, 1)
+	if w := time.Now().AddDate(0, 0, -revisionWindow()); w.Before(start) {
+		start = w
+	}
+	// A failed optional dataset leaves zeroes in every crawled day, which
+	// must not overwrite what is stored. Revisions wait for a clean run.
+	failed := rep.Errored(datasets...)
+	if len(failed) > 0 {
+		log.Printf("not revising stored days, %s failed", strings.Join(failed, ", "))
 	}
-	t, _ := time.Parse("2006-01-02", latest.Date)
 
-	for d := t.AddDate(0, 0, 1); !d.After(time.Now()); d = d.AddDate(0, 0, 1) {
-		if v, ok := new[d.Format("2006-01-02")]; ok {
-			_, err := saveToMongo(collection, v)
+	for d := start; !d.After(time.Now()); d = d.AddDate(0, 0, 1) {
+		v, ok := new[d.Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		old, err := repo.ByDate(ctx, v.Date)
+		if err == repository.ErrNotFound {
+			old, err = nil, nil
+		}
+		if err != nil {
+			rep.Errors = append(rep.Errors, fmt.Sprintf("read %s: %s", v.Date, err))
+			continue
+		}
+		if old != nil && len(failed) > 0 {
+			continue
+		}
+		var revs []model.Revision
+		if old != nil {
+			revs, err = diffRecords(*old, v, time.Now())
 			if err != nil {
-				log.Println(err.Error())
+				rep.Errors = append(rep.Errors, fmt.Sprintf("diff %s: %s", v.Date, err))
+				continue
 			}
-			sendToSlack(v)
+			if len(revs) == 0 {
+				continue
+			}
+		}
+		if err := repo.Upsert(ctx, v); err != nil {
+			rep.Errors = append(rep.Errors, fmt.Sprintf("save %s: %s", v.Date, err))
+			continue
 		}
+		if old != nil {
+			if err := repo.SaveRevisions(ctx, revs); err != nil {
+				rep.Errors = append(rep.Errors, fmt.Sprintf("revisions %s: %s", v.Date, err))
+			}
+			rep.Revised = append(rep.Revised, v.Date)
+			continue
+		}
+		rep.Saved = append(rep.Saved, v.Date)
+		pub.publish(ctx, repo, v, rep)
 	}
+	if len(rep.Errors) > 0 {
+		return rep, fmt.Errorf("%d errors while saving records", len(rep.Errors))
+	}
+	return rep, nil
 }
 
-func initMongoRecord(col *mongo.Collection) {
-	cases := get()
+// withMetrics returns rec with its derived metrics filled in from the
+// stored days before it. On failure rec is returned without them.
+func withMetrics(ctx context.Context, repo repository.RecordRepository, rec model.Record) model.Record {
+	if err := metrics.Load(ctx, repo, []*model.Record{&rec}); err != nil {
+		log.Println("metrics:", err)
+	}
+	return rec
+}
+
+func initMongoRecord(repo repository.RecordRepository) {
+	cases, _ := get(context.TODO(), NewSource(nil))
 	for _, v := range cases {
-		ir, _ := saveToMongo(col, v)
-		fmt.Println(ir, v.Date)
+		err := repo.Upsert(context.TODO(), v)
+		fmt.Println(err, v.Date)
 	}
 
 }
@@ -214,32 +164,35 @@ func truncateMongo(col *mongo.Collection) {
 	fmt.Println(dr)
 }
 
-func saveToMongo(col *mongo.Collection, rec Record) (*mongo.InsertOneResult, error) {
-	insertResult, err := col.InsertOne(context.TODO(), rec)
-	if err != nil {
-		return nil, err
-	}
-	return insertResult, nil
-}
-
-func get() map[string]Record {
-	cases := getCountry()
-	states := getStateMap()
-	deaths := getDeaths()
-	deathStates := getDeathByState()
-	hospital := getHostpital()
-	icu := getICU()
-	pkrc := getPKRC()
-	pop := getPopulation()
-	tests := getTestByCountry()
-	testStates := getTestByState()
+func get(ctx context.Context, src Source) (map[string]model.Record, *Report) {
+	rep := &Report{}
+	src = fetchAll(ctx, src, datasets, fetchWorkers())
+	cases := getCountry(ctx, src, rep)
+	states := getStateMap(ctx, src, rep)
+	deaths := getDeaths(ctx, src, rep)
+	deathStates := getDeathByState(ctx, src, rep)
+	hospital := getHostpital(ctx, src, rep)
+	icu := getICU(ctx, src, rep)
+	pkrc := getPKRC(ctx, src, rep)
+	pop := getPopulation(ctx, src, rep)
+	tests := getTestByCountry(ctx, src, rep)
+	testStates := getTestByState(ctx, src, rep)
+	vax := getVaxByCountry(ctx, src, rep)
+	vaxStates := getVaxByState(ctx, src, rep)
 	for k, v := range cases {
-		id, _ := primitive.ObjectIDFromHex(k)
+		id, err := model.IDFromDate(k)
+		if err != nil {
+			rep.Errors = append(rep.Errors, fmt.Sprintf("date %q: %s", k, err))
+			delete(cases, k)
+			continue
+		}
 		v.ID = id
+		v.SchemaVersion = model.SchemaVersion
 		v.Population = pop["Malaysia"]
 		v.Death = deaths[k]
 		v.States = states[k]
 		v.Test = tests[k]
+		v.Vaccination = vax[k]
 		for key, val := range v.States {
 			val.Death = deathStates[k][key]
 			val.Hospital = hospital[k][key]
@@ -247,160 +200,114 @@ func get() map[string]Record {
 			val.PKRC = pkrc[k][key]
 			val.Population = pop[key]
 			val.Test = testStates[k][key]
+			val.Vaccination = vaxStates[k][key]
 			v.States[key] = val
 		}
 		cases[k] = v
 	}
-	return cases
+	return cases, rep
 }
 
-func getCountry() map[string]Record {
-	res := map[string]Record{}
-	cdata, _ := readCSVFromUrl("https://raw.githubusercontent.com/MoH-Malaysia/covid19-public/main/epidemic/cases_malaysia.csv")
-	for i, crow := range cdata {
-		if i == 0 {
-			continue
-		}
-		cr := strings.Split(crow[0], ",")
-		cn, _ := strconv.Atoi(cr[1])
-		ci, _ := strconv.Atoi(cr[2])
-		crec, _ := strconv.Atoi(cr[3])
-		ac, _ := strconv.Atoi(cr[4])
-		cc, _ := strconv.Atoi(cr[5])
-		pv, _ := strconv.Atoi(cr[6])
-		fv, _ := strconv.Atoi(cr[7])
-		cch, _ := strconv.Atoi(cr[8])
-		adoc, _ := strconv.Atoi(cr[9])
-		adc, _ := strconv.Atoi(cr[10])
-		ec, _ := strconv.Atoi(cr[11])
-		cli, _ := strconv.Atoi(cr[12])
-		clr, _ := strconv.Atoi(cr[13])
-		clc, _ := strconv.Atoi(cr[14])
-		clh, _ := strconv.Atoi(cr[15])
-		cle, _ := strconv.Atoi(cr[16])
-		cld, _ := strconv.Atoi(cr[17])
-		clw, _ := strconv.Atoi(cr[18])
-		res[cr[0]] = Record{
-			Date:              cr[0],
-			NewCases:          cn,
-			ImportCases:       ci,
-			RecoveredCases:    crec,
-			ActiveCases:       ac,
-			ClusterCases:      cc,
-			PVax:              pv,
-			FVax:              fv,
-			ChildCases:        cch,
-			AdolescentCases:   adoc,
-			AdultCases:        adc,
-			ElderlyCases:      ec,
-			ClusterImport:     cli,
-			ClusterReligious:  clr,
-			ClusterCommunity:  clc,
-			ClusterHighRisk:   clh,
-			ClusterEducation:  cle,
-			ClusterDentention: cld,
-			ClusterWorkplace:  clw,
+func getCountry(ctx context.Context, src Source, rep *Report) map[string]model.Record {
+	type tempCountry struct {
+		Date              string `csv:"date"`
+		NewCases          int    `csv:"cases_new"`
+		ImportCases       int    `csv:"cases_import"`
+		RecoveredCases    int    `csv:"cases_recovered"`
+		ActiveCases       int    `csv:"cases_active"`
+		ClusterCases      int    `csv:"cases_cluster"`
+		PVax              int    `csv:"cases_pvax"`
+		FVax              int    `csv:"cases_fvax"`
+		ChildCases        int    `csv:"cases_child"`
+		AdolescentCases   int    `csv:"cases_adolescent"`
+		AdultCases        int    `csv:"cases_adult"`
+		ElderlyCases      int    `csv:"cases_elderly"`
+		ClusterImport     int    `csv:"cluster_import"`
+		ClusterReligious  int    `csv:"cluster_religious"`
+		ClusterCommunity  int    `csv:"cluster_community"`
+		ClusterHighRisk   int    `csv:"cluster_highRisk"`
+		ClusterEducation  int    `csv:"cluster_education"`
+		ClusterDentention int    `csv:"cluster_detentionCentre"`
+		ClusterWorkplace  int    `csv:"cluster_workplace"`
+	}
+	res := map[string]model.Record{}
+	tcs := []tempCountry{}
+	rep.load(ctx, src, "epidemic/cases_malaysia.csv", &tcs)
+	for _, v := range tcs {
+		res[v.Date] = model.Record{
+			Date:              v.Date,
+			NewCases:          v.NewCases,
+			ImportCases:       v.ImportCases,
+			RecoveredCases:    v.RecoveredCases,
+			ActiveCases:       v.ActiveCases,
+			ClusterCases:      v.ClusterCases,
+			PVax:              v.PVax,
+			FVax:              v.FVax,
+			ChildCases:        v.ChildCases,
+			AdolescentCases:   v.AdolescentCases,
+			AdultCases:        v.AdultCases,
+			ElderlyCases:      v.ElderlyCases,
+			ClusterImport:     v.ClusterImport,
+			ClusterReligious:  v.ClusterReligious,
+			ClusterCommunity:  v.ClusterCommunity,
+			ClusterHighRisk:   v.ClusterHighRisk,
+			ClusterEducation:  v.ClusterEducation,
+			ClusterDentention: v.ClusterDentention,
+			ClusterWorkplace:  v.ClusterWorkplace,
 		}
 	}
 	return res
 }
 
-func readCSVFromUrl(url string) ([][]string, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	reader := csv.NewReader(resp.Body)
-	reader.Comma = ';'
-	data, err := reader.ReadAll()
-	if err != nil {
-		return nil, err
-	}
-	return data, nil
-}
-
-func getDeaths() map[string]Death {
-	res := map[string]Death{}
-	ddata, _ := readCSVFromUrl("https://raw.githubusercontent.com/MoH-Malaysia/covid19-public/main/epidemic/deaths_malaysia.csv")
-	for i, drow := range ddata {
-		if i == 0 {
-			continue
-		}
-		dr := strings.Split(drow[0], ",")
-		nd, _ := strconv.Atoi(dr[1])
-		ad, _ := strconv.Atoi(dr[3])
-		bd, _ := strconv.Atoi(dr[2])
-		abd, _ := strconv.Atoi(dr[4])
-		pv, _ := strconv.Atoi(dr[5])
-		fv, _ := strconv.Atoi(dr[6])
-		res[dr[0]] = Death{
-			NewDeaths:       nd,
-			ActualDeaths:    ad,
-			BIDDeaths:       bd,
-			ActualBIDDeaths: abd,
-			PVaxDeaths:      pv,
-			FVaxDeaths:      fv,
+func getDeaths(ctx context.Context, src Source, rep *Report) map[string]model.Death {
+	type tempDeath struct {
+		Date            string `csv:"date"`
+		NewDeaths       int    `csv:"deaths_new"`
+		ActualDeaths    int    `csv:"deaths_new_dod"`
+		BIDDeaths       int    `csv:"deaths_bid"`
+		ActualBIDDeaths int    `csv:"deaths_bid_dod"`
+		PVaxDeaths      int    `csv:"deaths_pvax"`
+		FVaxDeaths      int    `csv:"deaths_fvax"`
+	}
+	res := map[string]model.Death{}
+	tds := []tempDeath{}
+	rep.load(ctx, src, "epidemic/deaths_malaysia.csv", &tds)
+	for _, v := range tds {
+		res[v.Date] = model.Death{
+			NewDeaths:       v.NewDeaths,
+			ActualDeaths:    v.ActualDeaths,
+			BIDDeaths:       v.BIDDeaths,
+			ActualBIDDeaths: v.ActualBIDDeaths,
+			PVaxDeaths:      v.PVaxDeaths,
+			FVaxDeaths:      v.FVaxDeaths,
 		}
 	}
 	return res
 }
 
-func getStateMap() map[string]map[string]State {
-	test := map[string]map[string]State{}
+func getStateMap(ctx context.Context, src Source, rep *Report) map[string]map[string]model.State {
+	test := map[string]map[string]model.State{}
 	type tempState struct {
-		Date            string
-		Name            string
-		ImportCases     int
-		NewCases        int
-		RecoveredCases  int
-		ActiveCases     int
-		ClusterCases    int
-		PVax            int
-		FVax            int
-		ChildCases      int
-		AdolescentCases int
-		AdultCases      int
-		ElderlyCases    int
-		Death           Death
-	}
-	sdata, _ := readCSVFromUrl("https://raw.githubusercontent.com/MoH-Malaysia/covid19-public/main/epidemic/cases_state.csv")
-	states := []tempState{}
-	for i, srow := range sdata {
-		if i == 0 {
-			continue
-		}
-		sr := strings.Split(srow[0], ",")
-		nc, _ := strconv.Atoi(sr[2])
-		ic, _ := strconv.Atoi(sr[3])
-		rc, _ := strconv.Atoi(sr[4])
-		ac, _ := strconv.Atoi(sr[5])
-		cc, _ := strconv.Atoi(sr[6])
-		pv, _ := strconv.Atoi(sr[7])
-		fv, _ := strconv.Atoi(sr[8])
-		cch, _ := strconv.Atoi(sr[9])
-		adoc, _ := strconv.Atoi(sr[10])
-		adc, _ := strconv.Atoi(sr[11])
-		ec, _ := strconv.Atoi(sr[12])
-		states = append(states, tempState{
-			Date:            sr[0],
-			Name:            sr[1],
-			ImportCases:     ic,
-			NewCases:        nc,
-			RecoveredCases:  rc,
-			ActiveCases:     ac,
-			ClusterCases:    cc,
-			PVax:            pv,
-			FVax:            fv,
-			ChildCases:      cch,
-			AdolescentCases: adoc,
-			AdultCases:      adc,
-			ElderlyCases:    ec,
-		})
+		Date            string `csv:"date"`
+		Name            string `csv:"state"`
+		ImportCases     int    `csv:"cases_import"`
+		NewCases        int    `csv:"cases_new"`
+		RecoveredCases  int    `csv:"cases_recovered"`
+		ActiveCases     int    `csv:"cases_active"`
+		ClusterCases    int    `csv:"cases_cluster"`
+		PVax            int    `csv:"cases_pvax"`
+		FVax            int    `csv:"cases_fvax"`
+		ChildCases      int    `csv:"cases_child"`
+		AdolescentCases int    `csv:"cases_adolescent"`
+		AdultCases      int    `csv:"cases_adult"`
+		ElderlyCases    int    `csv:"cases_elderly"`
+		Death           model.Death
 	}
+	states := []tempState{}
+	rep.load(ctx, src, "epidemic/cases_state.csv", &states)
 	for _, v := range states {
 		if _, ok := test[v.Date]; ok {
-			test[v.Date][v.Name] = State{
+			test[v.Date][v.Name] = model.State{
 				Name:            v.Name,
 				ImportCases:     v.ImportCases,
 				NewCases:        v.NewCases,
@@ -415,7 +322,7 @@ func getStateMap() map[string]map[string]State {
 				ElderlyCases:    v.ElderlyCases,
 			}
 		} else {
-			test[v.Date] = map[string]State{v.Name: {
+			test[v.Date] = map[string]model.State{v.Name: {
 				Name:            v.Name,
 				ImportCases:     v.ImportCases,
 				NewCases:        v.NewCases,
@@ -434,45 +341,23 @@ func getStateMap() map[string]map[string]State {
 	return test
 }
 
-func getDeathByState() map[string]map[string]Death {
+func getDeathByState(ctx context.Context, src Source, rep *Report) map[string]map[string]model.Death {
 	type tempDeath struct {
-		Date            string
-		Name            string
-		NewDeaths       int
-		ActualDeaths    int
-		BIDDeaths       int
-		ActualBIDDeaths int
-		PVaxDeaths      int
-		FVaxDeaths      int
-	}
-	res := map[string]map[string]Death{}
-	sdata, _ := readCSVFromUrl("https://raw.githubusercontent.com/MoH-Malaysia/covid19-public/main/epidemic/deaths_state.csv")
+		Date            string `csv:"date"`
+		Name            string `csv:"state"`
+		NewDeaths       int    `csv:"deaths_new"`
+		ActualDeaths    int    `csv:"deaths_new_dod"`
+		BIDDeaths       int    `csv:"deaths_bid"`
+		ActualBIDDeaths int    `csv:"deaths_bid_dod"`
+		PVaxDeaths      int    `csv:"deaths_pvax"`
+		FVaxDeaths      int    `csv:"deaths_fvax"`
+	}
+	res := map[string]map[string]model.Death{}
 	deathByStates := []tempDeath{}
-	for i, srow := range sdata {
-		if i == 0 {
-			continue
-		}
-		sr := strings.Split(srow[0], ",")
-		nd, _ := strconv.Atoi(sr[2])
-		ad, _ := strconv.Atoi(sr[4])
-		bd, _ := strconv.Atoi(sr[3])
-		abd, _ := strconv.Atoi(sr[5])
-		pv, _ := strconv.Atoi(sr[6])
-		fv, _ := strconv.Atoi(sr[7])
-		deathByStates = append(deathByStates, tempDeath{
-			Date:            sr[0],
-			Name:            sr[1],
-			NewDeaths:       nd,
-			ActualDeaths:    ad,
-			BIDDeaths:       bd,
-			ActualBIDDeaths: abd,
-			PVaxDeaths:      pv,
-			FVaxDeaths:      fv,
-		})
-	}
+	rep.load(ctx, src, "epidemic/deaths_state.csv", &deathByStates)
 	for _, v := range deathByStates {
 		if _, ok := res[v.Date]; ok {
-			res[v.Date][v.Name] = Death{
+			res[v.Date][v.Name] = model.Death{
 				NewDeaths:       v.NewDeaths,
 				ActualDeaths:    v.ActualDeaths,
 				BIDDeaths:       v.BIDDeaths,
@@ -481,7 +366,7 @@ func getDeathByState() map[string]map[string]Death {
 				FVaxDeaths:      v.FVaxDeaths,
 			}
 		} else {
-			res[v.Date] = map[string]Death{v.Name: {
+			res[v.Date] = map[string]model.Death{v.Name: {
 				NewDeaths:       v.NewDeaths,
 				ActualDeaths:    v.ActualDeaths,
 				BIDDeaths:       v.BIDDeaths,
@@ -494,63 +379,29 @@ func getDeathByState() map[string]map[string]Death {
 	return res
 }
 
-func getHostpital() map[string]map[string]Hospital {
+func getHostpital(ctx context.Context, src Source, rep *Report) map[string]map[string]model.Hospital {
 	type tempHospital struct {
-		Date                 string
-		Name                 string
-		Beds                 int
-		CovidBeds            int
-		NonCriticalBeds      int
-		AdmittedPUI          int
-		AdmittedCovid        int
-		AdmittedTotal        int
-		DischargedPui        int
-		DischargedCovid      int
-		DischargedTotal      int
-		HospitalizedCovid    int
-		HospitalizedPui      int
-		HospitalizedNonCovid int
-	}
-	res := map[string]map[string]Hospital{}
-	hdata, _ := readCSVFromUrl("https://raw.githubusercontent.com/MoH-Malaysia/covid19-public/main/epidemic/hospital.csv")
+		Date                 string `csv:"date"`
+		Name                 string `csv:"state"`
+		Beds                 int    `csv:"beds"`
+		CovidBeds            int    `csv:"beds_covid"`
+		NonCriticalBeds      int    `csv:"beds_noncrit"`
+		AdmittedPUI          int    `csv:"admitted_pui"`
+		AdmittedCovid        int    `csv:"admitted_covid"`
+		AdmittedTotal        int    `csv:"admitted_total"`
+		DischargedPui        int    `csv:"discharged_pui"`
+		DischargedCovid      int    `csv:"discharged_covid"`
+		DischargedTotal      int    `csv:"discharged_total"`
+		HospitalizedCovid    int    `csv:"hosp_covid"`
+		HospitalizedPui      int    `csv:"hosp_pui"`
+		HospitalizedNonCovid int    `csv:"hosp_noncovid"`
+	}
+	res := map[string]map[string]model.Hospital{}
 	ths := []tempHospital{}
-	for i, hrow := range hdata {
-		if i == 0 {
-			continue
-		}
-		hr := strings.Split(hrow[0], ",")
-		b, _ := strconv.Atoi(hr[2])
-		bc, _ := strconv.Atoi(hr[3])
-		bnc, _ := strconv.Atoi(hr[4])
-		ap, _ := strconv.Atoi(hr[5])
-		ac, _ := strconv.Atoi(hr[6])
-		at, _ := strconv.Atoi(hr[7])
-		dp, _ := strconv.Atoi(hr[8])
-		dc, _ := strconv.Atoi(hr[9])
-		dt, _ := strconv.Atoi(hr[10])
-		hc, _ := strconv.Atoi(hr[11])
-		hp, _ := strconv.Atoi(hr[12])
-		hnc, _ := strconv.Atoi(hr[13])
-		ths = append(ths, tempHospital{
-			Date:                 hr[0],
-			Name:                 hr[1],
-			Beds:                 b,
-			CovidBeds:            bc,
-			NonCriticalBeds:      bnc,
-			AdmittedPUI:          ap,
-			AdmittedCovid:        ac,
-			AdmittedTotal:        at,
-			DischargedPui:        dp,
-			DischargedCovid:      dc,
-			DischargedTotal:      dt,
-			HospitalizedCovid:    hc,
-			HospitalizedPui:      hp,
-			HospitalizedNonCovid: hnc,
-		})
-	}
+	rep.load(ctx, src, "epidemic/hospital.csv", &ths)
 	for _, v := range ths {
 		if _, ok := res[v.Date]; ok {
-			res[v.Date][v.Name] = Hospital{
+			res[v.Date][v.Name] = model.Hospital{
 				CovidBeds:            v.CovidBeds,
 				Beds:                 v.Beds,
 				NonCriticalBeds:      v.NonCriticalBeds,
@@ -565,7 +416,7 @@ func getHostpital() map[string]map[string]Hospital {
 				HospitalizedNonCovid: v.HospitalizedNonCovid,
 			}
 		} else {
-			res[v.Date] = map[string]Hospital{v.Name: {
+			res[v.Date] = map[string]model.Hospital{v.Name: {
 				CovidBeds:            v.CovidBeds,
 				Beds:                 v.Beds,
 				NonCriticalBeds:      v.NonCriticalBeds,
@@ -584,69 +435,31 @@ func getHostpital() map[string]map[string]Hospital {
 	return res
 }
 
-func getICU() map[string]map[string]ICU {
+func getICU(ctx context.Context, src Source, rep *Report) map[string]map[string]model.ICU {
 	type tempICU struct {
-		Date                string
-		Name                string
-		ICUBeds             int
-		ICUBedsRep          int
-		ICUBedsTotal        int
-		ICUBedsCovid        int
-		Ventilators         int
-		PortableVentilators int
-		ICUCovid            int
-		ICUPui              int
-		ICUNonCovid         int
-		VentCovid           int
-		VentPui             int
-		VentNonCovid        int
-		VentUsed            int
-		PortVentUsed        int
-	}
-	res := map[string]map[string]ICU{}
-	idata, _ := readCSVFromUrl("https://raw.githubusercontent.com/MoH-Malaysia/covid19-public/main/epidemic/icu.csv")
+		Date                string `csv:"date"`
+		Name                string `csv:"state"`
+		ICUBeds             int    `csv:"beds_icu"`
+		ICUBedsRep          int    `csv:"beds_icu_rep"`
+		ICUBedsTotal        int    `csv:"beds_icu_total"`
+		ICUBedsCovid        int    `csv:"beds_icu_covid"`
+		Ventilators         int    `csv:"vent"`
+		PortableVentilators int    `csv:"vent_port"`
+		ICUCovid            int    `csv:"icu_covid"`
+		ICUPui              int    `csv:"icu_pui"`
+		ICUNonCovid         int    `csv:"icu_noncovid"`
+		VentCovid           int    `csv:"vent_covid"`
+		VentPui             int    `csv:"vent_pui"`
+		VentNonCovid        int    `csv:"vent_noncovid"`
+		VentUsed            int    `csv:"vent_used"`
+		PortVentUsed        int    `csv:"vent_port_used"`
+	}
+	res := map[string]map[string]model.ICU{}
 	tis := []tempICU{}
-	for i, irow := range idata {
-		if i == 0 {
-			continue
-		}
-		ir := strings.Split(irow[0], ",")
-		b, _ := strconv.Atoi(ir[2])
-		br, _ := strconv.Atoi(ir[3])
-		bt, _ := strconv.Atoi(ir[4])
-		bc, _ := strconv.Atoi(ir[5])
-		v, _ := strconv.Atoi(ir[6])
-		vp, _ := strconv.Atoi(ir[7])
-		ic, _ := strconv.Atoi(ir[8])
-		ip, _ := strconv.Atoi(ir[9])
-		inc, _ := strconv.Atoi(ir[10])
-		vc, _ := strconv.Atoi(ir[11])
-		vpui, _ := strconv.Atoi(ir[12])
-		vnc, _ := strconv.Atoi(ir[13])
-		vu, _ := strconv.Atoi(ir[14])
-		vpu, _ := strconv.Atoi(ir[15])
-		tis = append(tis, tempICU{
-			Date:                ir[0],
-			Name:                ir[1],
-			ICUBeds:             b,
-			ICUBedsRep:          br,
-			ICUBedsTotal:        bt,
-			ICUBedsCovid:        bc,
-			Ventilators:         v,
-			PortableVentilators: vp,
-			ICUCovid:            ic,
-			ICUPui:              ip,
-			ICUNonCovid:         inc,
-			VentCovid:           vc,
-			VentPui:             vpui,
-			VentNonCovid:        vnc,
-			VentUsed:            vu,
-			PortVentUsed:        vpu,
-		})
-	}
+	rep.load(ctx, src, "epidemic/icu.csv", &tis)
 	for _, v := range tis {
 		if _, ok := res[v.Date]; ok {
-			res[v.Date][v.Name] = ICU{
+			res[v.Date][v.Name] = model.ICU{
 				ICUBeds:             v.ICUBeds,
 				ICUBedsRep:          v.ICUBedsRep,
 				ICUBedsTotal:        v.ICUBedsTotal,
@@ -663,7 +476,7 @@ func getICU() map[string]map[string]ICU {
 				PortVentUsed:        v.PortVentUsed,
 			}
 		} else {
-			res[v.Date] = map[string]ICU{v.Name: {
+			res[v.Date] = map[string]model.ICU{v.Name: {
 				ICUBeds:             v.ICUBeds,
 				ICUBedsRep:          v.ICUBedsRep,
 				ICUBedsTotal:        v.ICUBedsTotal,
@@ -684,57 +497,27 @@ func getICU() map[string]map[string]ICU {
 	return res
 }
 
-func getPKRC() map[string]map[string]PKRC {
+func getPKRC(ctx context.Context, src Source, rep *Report) map[string]map[string]model.PKRC {
 	type tempPKRC struct {
-		Date            string
-		Name            string
-		Beds            int
-		AdmittedCovid   int
-		AdmittedPui     int
-		AdmittedTotal   int
-		DischargedPui   int
-		DischargedCovid int
-		DischargedTotal int
-		PKRCCovid       int
-		PKRCPui         int
-		PKRCNonCovid    int
-	}
-	res := map[string]map[string]PKRC{}
-	pdata, _ := readCSVFromUrl("https://raw.githubusercontent.com/MoH-Malaysia/covid19-public/main/epidemic/pkrc.csv")
+		Date            string `csv:"date"`
+		Name            string `csv:"state"`
+		Beds            int    `csv:"beds"`
+		AdmittedCovid   int    `csv:"admitted_covid"`
+		AdmittedPui     int    `csv:"admitted_pui"`
+		AdmittedTotal   int    `csv:"admitted_total"`
+		DischargedPui   int    `csv:"discharge_pui"`
+		DischargedCovid int    `csv:"discharge_covid"`
+		DischargedTotal int    `csv:"discharge_total"`
+		PKRCCovid       int    `csv:"pkrc_covid"`
+		PKRCPui         int    `csv:"pkrc_pui"`
+		PKRCNonCovid    int    `csv:"pkrc_noncovid"`
+	}
+	res := map[string]map[string]model.PKRC{}
 	tps := []tempPKRC{}
-	for i, prow := range pdata {
-		if i == 0 {
-			continue
-		}
-		pr := strings.Split(prow[0], ",")
-		b, _ := strconv.Atoi(pr[2])
-		ap, _ := strconv.Atoi(pr[3])
-		ac, _ := strconv.Atoi(pr[4])
-		at, _ := strconv.Atoi(pr[5])
-		dp, _ := strconv.Atoi(pr[6])
-		dc, _ := strconv.Atoi(pr[7])
-		dt, _ := strconv.Atoi(pr[8])
-		pc, _ := strconv.Atoi(pr[9])
-		pp, _ := strconv.Atoi(pr[10])
-		pnc, _ := strconv.Atoi(pr[11])
-		tps = append(tps, tempPKRC{
-			Date:            pr[0],
-			Name:            pr[1],
-			Beds:            b,
-			AdmittedPui:     ap,
-			AdmittedCovid:   ac,
-			AdmittedTotal:   at,
-			DischargedPui:   dp,
-			DischargedCovid: dc,
-			DischargedTotal: dt,
-			PKRCCovid:       pc,
-			PKRCPui:         pp,
-			PKRCNonCovid:    pnc,
-		})
-	}
+	rep.load(ctx, src, "epidemic/pkrc.csv", &tps)
 	for _, v := range tps {
 		if _, ok := res[v.Date]; ok {
-			res[v.Date][v.Name] = PKRC{
+			res[v.Date][v.Name] = model.PKRC{
 				Beds:            v.Beds,
 				AdmittedPui:     v.AdmittedPui,
 				AdmittedCovid:   v.AdmittedCovid,
@@ -747,7 +530,7 @@ func getPKRC() map[string]map[string]PKRC {
 				PKRCNonCovid:    v.PKRCNonCovid,
 			}
 		} else {
-			res[v.Date] = map[string]PKRC{v.Name: {
+			res[v.Date] = map[string]model.PKRC{v.Name: {
 				Beds:            v.Beds,
 				AdmittedPui:     v.AdmittedPui,
 				AdmittedCovid:   v.AdmittedCovid,
@@ -764,56 +547,42 @@ func getPKRC() map[string]map[string]PKRC {
 	return res
 }
 
-func getTestByCountry() map[string]Test {
-	res := map[string]Test{}
-	tdata, _ := readCSVFromUrl("https://raw.githubusercontent.com/MoH-Malaysia/covid19-public/main/epidemic/tests_malaysia.csv")
-	for i, trow := range tdata {
-		if i == 0 {
-			continue
-		}
-		tr := strings.Split(trow[0], ",")
-		rtkAg, _ := strconv.Atoi(tr[1])
-		pcr, _ := strconv.Atoi(tr[2])
-		res[tr[0]] = Test{
-			RtkAg: rtkAg,
-			Pcr:   pcr,
+func getTestByCountry(ctx context.Context, src Source, rep *Report) map[string]model.Test {
+	type tempTest struct {
+		Date  string `csv:"date"`
+		RtkAg int    `csv:"rtk-ag"`
+		Pcr   int    `csv:"pcr"`
+	}
+	res := map[string]model.Test{}
+	ts := []tempTest{}
+	rep.load(ctx, src, "epidemic/tests_malaysia.csv", &ts)
+	for _, v := range ts {
+		res[v.Date] = model.Test{
+			RtkAg: v.RtkAg,
+			Pcr:   v.Pcr,
 		}
 	}
 	return res
 }
 
-func getTestByState() map[string]map[string]Test {
+func getTestByState(ctx context.Context, src Source, rep *Report) map[string]map[string]model.Test {
 	type tempTest struct {
-		Date  string
-		Name  string
-		RtkAg int
-		Pcr   int
+		Date  string `csv:"date"`
+		Name  string `csv:"state"`
+		RtkAg int    `csv:"rtk-ag"`
+		Pcr   int    `csv:"pcr"`
 	}
-	res := map[string]map[string]Test{}
-	pdata, _ := readCSVFromUrl("https://raw.githubusercontent.com/MoH-Malaysia/covid19-public/main/epidemic/tests_state.csv")
+	res := map[string]map[string]model.Test{}
 	ts := []tempTest{}
-	for i, trow := range pdata {
-		if i == 0 {
-			continue
-		}
-		tr := strings.Split(trow[0], ",")
-		rtkAg, _ := strconv.Atoi(tr[2])
-		pcr, _ := strconv.Atoi(tr[3])
-		ts = append(ts, tempTest{
-			Date:  tr[0],
-			Name:  tr[1],
-			RtkAg: rtkAg,
-			Pcr:   pcr,
-		})
-	}
+	rep.load(ctx, src, "epidemic/tests_state.csv", &ts)
 	for _, v := range ts {
 		if _, ok := res[v.Date]; ok {
-			res[v.Date][v.Name] = Test{
+			res[v.Date][v.Name] = model.Test{
 				RtkAg: v.RtkAg,
 				Pcr:   v.Pcr,
 			}
 		} else {
-			res[v.Date] = map[string]Test{v.Name: {
+			res[v.Date] = map[string]model.Test{v.Name: {
 				RtkAg: v.RtkAg,
 				Pcr:   v.Pcr,
 			}}
@@ -822,23 +591,108 @@ func getTestByState() map[string]map[string]Test {
 	return res
 }
 
-func getPopulation() map[string]Population {
-	res := map[string]Population{}
-	pdata, _ := readCSVFromUrl("https://raw.githubusercontent.com/MoH-Malaysia/covid19-public/main/static/population.csv")
-	for i, prow := range pdata {
-		if i == 0 {
-			continue
+// tempVax holds the columns shared by vax_malaysia.csv and vax_state.csv;
+// the state column only exists in the latter.
+type tempVax struct {
+	Date              string `csv:"date"`
+	Name              string `csv:"state,optional"`
+	DailyPartial      int    `csv:"daily_partial"`
+	DailyFull         int    `csv:"daily_full"`
+	DailyBooster      int    `csv:"daily_booster,optional"`
+	Daily             int    `csv:"daily"`
+	DailyPartialChild int    `csv:"daily_partial_child,optional"`
+	DailyFullChild    int    `csv:"daily_full_child,optional"`
+	CumulPartial      int    `csv:"cumul_partial"`
+	CumulFull         int    `csv:"cumul_full"`
+	CumulBooster      int    `csv:"cumul_booster,optional"`
+	Cumul             int    `csv:"cumul"`
+	CumulPartialChild int    `csv:"cumul_partial_child,optional"`
+	CumulFullChild    int    `csv:"cumul_full_child,optional"`
+	Pfizer1           int    `csv:"pfizer1"`
+	Pfizer2           int    `csv:"pfizer2"`
+	Pfizer3           int    `csv:"pfizer3,optional"`
+	Sinovac1          int    `csv:"sinovac1"`
+	Sinovac2          int    `csv:"sinovac2"`
+	Sinovac3          int    `csv:"sinovac3,optional"`
+	Astra1            int    `csv:"astra1"`
+	Astra2            int    `csv:"astra2"`
+	Astra3            int    `csv:"astra3,optional"`
+	Sinopharm1        int    `csv:"sinopharm1,optional"`
+	Sinopharm2        int    `csv:"sinopharm2,optional"`
+	Sinopharm3        int    `csv:"sinopharm3,optional"`
+	Cansino           int    `csv:"cansino"`
+	Cansino3          int    `csv:"cansino3,optional"`
+	Pending           int    `csv:"pending,optional"`
+	Pending1          int    `csv:"pending1,optional"`
+	Pending2          int    `csv:"pending2,optional"`
+	Pending3          int    `csv:"pending3,optional"`
+}
+
+func (v tempVax) vaccination() model.Vaccination {
+	return model.Vaccination{
+		DailyPartial:      v.DailyPartial,
+		DailyFull:         v.DailyFull,
+		DailyBooster:      v.DailyBooster,
+		Daily:             v.Daily,
+		DailyPartialChild: v.DailyPartialChild,
+		DailyFullChild:    v.DailyFullChild,
+		CumulPartial:      v.CumulPartial,
+		CumulFull:         v.CumulFull,
+		CumulBooster:      v.CumulBooster,
+		Cumul:             v.Cumul,
+		CumulPartialChild: v.CumulPartialChild,
+		CumulFullChild:    v.CumulFullChild,
+		Pfizer:            model.Doses{Dose1: v.Pfizer1, Dose2: v.Pfizer2, Dose3: v.Pfizer3},
+		Sinovac:           model.Doses{Dose1: v.Sinovac1, Dose2: v.Sinovac2, Dose3: v.Sinovac3},
+		AstraZeneca:       model.Doses{Dose1: v.Astra1, Dose2: v.Astra2, Dose3: v.Astra3},
+		Sinopharm:         model.Doses{Dose1: v.Sinopharm1, Dose2: v.Sinopharm2, Dose3: v.Sinopharm3},
+		Cansino:           model.Doses{Dose1: v.Cansino, Dose3: v.Cansino3},
+		// Older files have a single "pending" column for doses whose dose
+		// number was not yet known.
+		Pending: model.Doses{Dose1: v.Pending + v.Pending1, Dose2: v.Pending2, Dose3: v.Pending3},
+	}
+}
+
+func getVaxByCountry(ctx context.Context, src Source, rep *Report) map[string]model.Vaccination {
+	res := map[string]model.Vaccination{}
+	tvs := []tempVax{}
+	rep.load(ctx, src, "vaccination/vax_malaysia.csv", &tvs)
+	for _, v := range tvs {
+		res[v.Date] = v.vaccination()
+	}
+	return res
+}
+
+func getVaxByState(ctx context.Context, src Source, rep *Report) map[string]map[string]model.Vaccination {
+	res := map[string]map[string]model.Vaccination{}
+	tvs := []tempVax{}
+	rep.load(ctx, src, "vaccination/vax_state.csv", &tvs)
+	for _, v := range tvs {
+		if _, ok := res[v.Date]; !ok {
+			res[v.Date] = map[string]model.Vaccination{}
 		}
-		pr := strings.Split(prow[0], ",")
-		p, _ := strconv.Atoi(pr[2])
-		po18, _ := strconv.Atoi(pr[3])
-		po60, _ := strconv.Atoi(pr[4])
-		po12, _ := strconv.Atoi(pr[5])
-		res[pr[0]] = Population{
-			Population: p,
-			Over18:     po18,
-			Over12:     po12,
-			Over60:     po60,
+		res[v.Date][v.Name] = v.vaccination()
+	}
+	return res
+}
+
+func getPopulation(ctx context.Context, src Source, rep *Report) map[string]model.Population {
+	type tempPopulation struct {
+		Name       string `csv:"state"`
+		Population int    `csv:"pop"`
+		Over18     int    `csv:"pop_18"`
+		Over60     int    `csv:"pop_60"`
+		Over12     int    `csv:"pop_12"`
+	}
+	res := map[string]model.Population{}
+	tps := []tempPopulation{}
+	rep.load(ctx, src, "static/population.csv", &tps)
+	for _, v := range tps {
+		res[v.Name] = model.Population{
+			Population: v.Population,
+			Over18:     v.Over18,
+			Over12:     v.Over12,
+			Over60:     v.Over60,
 		}
 	}
 	return res
@@ -857,63 +711,23 @@ func NewMongoClient() (*mongo.Client, error) {
 	return client, err
 }
 
-func sendToSlack(rec Record) {
-	flags := map[string]string{
-		"Selangor":          ":selangor:",
-		"W.P. Putrajaya":    ":putrajaya:",
-		"Kedah":             ":kedah:",
-		"Pulau Pinang":      ":ppinang:",
-		"Sarawak":           ":sarawak:",
-		"Kelantan":          ":kelantan:",
-		"Malaysia":          ":malaysia:",
-		"Johor":             ":johor:",
-		"W.P. Labuan":       ":labuan:",
-		"Melaka":            ":melaka:",
-		"Terengganu":        ":terengganu:",
-		"W.P. Kuala Lumpur": ":kl:",
-		"Sabah":             ":sabah:",
-		"Negeri Sembilan":   ":n9:",
-		"Perak":             ":perak:",
-		"Perlis":            ":perlis:",
-		"Pahang":            ":pahang:",
-	}
-	ranking := map[int]string{
-		0:  ":first_place_medal:",
-		1:  ":second_place_medal:",
-		2:  ":third_place_medal:",
-		3:  ":four:",
-		4:  ":five:",
-		5:  ":six:",
-		6:  ":seven:",
-		7:  ":eight:",
-		8:  ":nine:",
-		9:  ":keycap_ten:",
-		10: ":one::one:",
-		11: ":one::two:",
-		12: ":one::three:",
-		13: ":one::four:",
-		14: ":one::five:",
-		15: ":one::six:",
-		16: ":one::seven:",
-	}
-	s := []State{}
-	for _, v := range rec.States {
-		s = append(s, v)
-	}
-	sort.Slice(s, func(a, b int) bool {
-		return s[a].NewCases > s[b].NewCases
-	})
-	str := fmt.Sprintf("%s Data as of %s\n New Cases: %d \n Import Cases: %d \n Active Cases: %d \n Recovered Cases: %d \n New Deaths: %d \n New Brought in Dead (BID): %d\n Actual COVID Deaths: %d \n", flags["Malaysia"], rec.Date, rec.NewCases, rec.ImportCases, rec.RecoveredCases, rec.ActiveCases, rec.Death.NewDeaths, rec.Death.BIDDeaths, rec.Death.ActualDeaths)
-	req, _ := json.Marshal(map[string]string{
-		"text": str,
-	})
-	msg := ""
-	for i, v := range s {
-		msg += fmt.Sprintf("%s %s %s as of %s\n New Cases: %d \n Import Cases: %d \n Recovered Cases: %d \n Active Cases: %d \n New Deaths: %d \n Actual Deaths: %d \n Partially Vaccinated Deaths: %d \n Fully Vaccinated Deaths: %d \n\n", ranking[i], flags[v.Name], v.Name, rec.Date, v.NewCases, v.ImportCases, v.RecoveredCases, v.ActiveCases, v.Death.NewDeaths, v.Death.ActualDeaths, v.Death.PVaxDeaths, v.Death.FVaxDeaths)
-	}
-	_, _ = http.Post(os.Getenv("SLACK"), "application/json", bytes.NewBuffer(req))
-	rq, _ := json.Marshal(map[string]string{
-		"text": msg,
-	})
-	_, _ = http.Post(os.Getenv("SLACK"), "application/json", bytes.NewBuffer(rq))
+// flags are the Slack emoji for each state, and for the country.
+var flags = map[string]string{
+	"Selangor":          ":selangor:",
+	"W.P. Putrajaya":    ":putrajaya:",
+	"Kedah":             ":kedah:",
+	"Pulau Pinang":      ":ppinang:",
+	"Sarawak":           ":sarawak:",
+	"Kelantan":          ":kelantan:",
+	"Malaysia":          ":malaysia:",
+	"Johor":             ":johor:",
+	"W.P. Labuan":       ":labuan:",
+	"Melaka":            ":melaka:",
+	"Terengganu":        ":terengganu:",
+	"W.P. Kuala Lumpur": ":kl:",
+	"Sabah":             ":sabah:",
+	"Negeri Sembilan":   ":n9:",
+	"Perak":             ":perak:",
+	"Perlis":            ":perlis:",
+	"Pahang":            ":pahang:",
 }
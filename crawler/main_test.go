@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abx123/go-covid/alerts"
+	"github.com/abx123/go-covid/model"
+	"github.com/abx123/go-covid/notify"
+	"github.com/abx123/go-covid/repository"
+)
+
+// headers are the columns of each dataset, as in covid19-public.
+var headers = map[string]string{
+	"epidemic/cases_malaysia.csv":  "date,cases_new,cases_import,cases_recovered,cases_active,cases_cluster,cases_pvax,cases_fvax,cases_child,cases_adolescent,cases_adult,cases_elderly,cluster_import,cluster_religious,cluster_community,cluster_highRisk,cluster_education,cluster_detentionCentre,cluster_workplace",
+	"epidemic/cases_state.csv":     "date,state,cases_import,cases_new,cases_recovered,cases_active,cases_cluster,cases_pvax,cases_fvax,cases_child,cases_adolescent,cases_adult,cases_elderly",
+	"epidemic/deaths_malaysia.csv": "date,deaths_new,deaths_new_dod,deaths_bid,deaths_bid_dod,deaths_pvax,deaths_fvax",
+	"epidemic/deaths_state.csv":    "date,state,deaths_new,deaths_new_dod,deaths_bid,deaths_bid_dod,deaths_pvax,deaths_fvax",
+	"epidemic/hospital.csv":        "date,state,beds,beds_covid,beds_noncrit,admitted_pui,admitted_covid,admitted_total,discharged_pui,discharged_covid,discharged_total,hosp_covid,hosp_pui,hosp_noncovid",
+	"epidemic/icu.csv":             "date,state,beds_icu,beds_icu_rep,beds_icu_total,beds_icu_covid,vent,vent_port,icu_covid,icu_pui,icu_noncovid,vent_covid,vent_pui,vent_noncovid,vent_used,vent_port_used",
+	"epidemic/pkrc.csv":            "date,state,beds,admitted_covid,admitted_pui,admitted_total,discharge_pui,discharge_covid,discharge_total,pkrc_covid,pkrc_pui,pkrc_noncovid",
+	"epidemic/tests_malaysia.csv":  "date,rtk-ag,pcr",
+	"epidemic/tests_state.csv":     "date,state,rtk-ag,pcr",
+	"static/population.csv":        "state,pop,pop_18,pop_60,pop_12",
+	"vaccination/vax_malaysia.csv": "date,daily_partial,daily_full,daily,cumul_partial,cumul_full,cumul,pfizer1,pfizer2,sinovac1,sinovac2,astra1,astra2,cansino",
+	"vaccination/vax_state.csv":    "date,state,daily_partial,daily_full,daily,cumul_partial,cumul_full,cumul,pfizer1,pfizer2,sinovac1,sinovac2,astra1,astra2,cansino",
+}
+
+// writeFixtures lays out every dataset except skip under a temporary
+// directory, with one row per date in days for Malaysia and Selangor.
+// newCases gives the national new cases per day.
+func writeFixtures(t *testing.T, days []string, newCases map[string]int, skip ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	skipped := map[string]bool{}
+	for _, s := range skip {
+		skipped[s] = true
+	}
+	for name, header := range headers {
+		if skipped[name] {
+			continue
+		}
+		cols := strings.Split(header, ",")
+		lines := []string{header}
+		row := func(date, state string) string {
+			vals := make([]string, len(cols))
+			for i, c := range cols {
+				switch c {
+				case "date":
+					vals[i] = date
+				case "state":
+					vals[i] = state
+				case "cases_new":
+					vals[i] = fmt.Sprint(newCases[date])
+				case "pop":
+					vals[i] = "1000000"
+				case "beds_icu_total":
+					vals[i] = "100"
+				case "icu_covid":
+					vals[i] = "50"
+				default:
+					vals[i] = "1"
+				}
+			}
+			return strings.Join(vals, ",")
+		}
+		switch {
+		case name == "static/population.csv":
+			lines = append(lines, row("", "Malaysia"), row("", "Selangor"))
+		case strings.Contains(header, ",state,"):
+			for _, d := range days {
+				lines = append(lines, row(d, "Selangor"))
+			}
+		default:
+			for _, d := range days {
+				lines = append(lines, row(d, ""))
+			}
+		}
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// recorder is a Notifier that keeps what it was sent.
+type recorder struct {
+	mu   sync.Mutex
+	msgs []notify.Message
+}
+
+func (r *recorder) Notify(ctx context.Context, msg notify.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, msg)
+	return nil
+}
+
+func (r *recorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.msgs)
+}
+
+// daysAgo returns the dates n days before today, oldest first.
+func daysAgo(n ...int) []string {
+	res := []string{}
+	for _, v := range n {
+		res = append(res, time.Now().AddDate(0, 0, -v).Format("2006-01-02"))
+	}
+	return res
+}
+
+func TestIngest(t *testing.T) {
+	days := daysAgo(3, 2, 1)
+	root := writeFixtures(t, days, map[string]int{days[0]: 12, days[1]: 20, days[2]: 30})
+	repo := repository.NewMemory(model.Record{Date: days[0], NewCases: 10})
+	daily, capacity := &recorder{}, &recorder{}
+	pub := &publisher{rules: alerts.DefaultRules, daily: daily, capacity: capacity}
+
+	rep, err := ingest(context.Background(), repo, DirSource{Root: root}, pub)
+	if err != nil {
+		t.Fatalf("ingest: %v\n%s", err, rep)
+	}
+	if got, want := strings.Join(rep.Saved, ","), days[1]+","+days[2]; got != want {
+		t.Errorf("saved %s, want %s", got, want)
+	}
+	if got := strings.Join(rep.Revised, ","); got != days[0] {
+		t.Errorf("revised %s, want %s", got, days[0])
+	}
+	found := false
+	for _, r := range repo.Revisions() {
+		if r.Date == days[0] && r.Field == "newCases" {
+			found = fmt.Sprint(r.Old, "->", r.New) == "10->12"
+		}
+	}
+	if !found {
+		t.Errorf("no newCases revision 10->12 in %v", repo.Revisions())
+	}
+
+	rec, err := repo.ByDate(context.Background(), days[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.NewCases != 30 || rec.States["Selangor"].ICU.ICUCovid != 50 {
+		t.Errorf("stored %+v", rec)
+	}
+	if daily.count() != 2 || capacity.count() != 2 {
+		t.Errorf("sent %d daily and %d capacity reports, want 2 each", daily.count(), capacity.count())
+	}
+}
+
+// testRules fire for any day: one on cases alone, one on ICU capacity.
+var testRules = []alerts.Rule{
+	{Name: "any-cases", Metric: "newCases", Op: ">", Value: 0},
+	{Name: "any-icu", Metric: "derived.capacity.icu", Scope: alerts.ScopeStates, Op: ">", Value: 0},
+}
+
+func TestIngestOptionalDatasetFails(t *testing.T) {
+	tests := []struct {
+		missing  string
+		capacity int
+		alerts   []string
+	}{
+		{missing: "epidemic/icu.csv", capacity: 0, alerts: []string{"any-cases"}},
+		{missing: "vaccination/vax_state.csv", capacity: 2, alerts: []string{"any-cases", "any-icu"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.missing, func(t *testing.T) {
+			days := daysAgo(2, 1)
+			root := writeFixtures(t, days, map[string]int{days[0]: 5, days[1]: 6}, tc.missing)
+			repo := repository.NewMemory(model.Record{Date: time.Now().AddDate(0, 0, -30).Format("2006-01-02")})
+			daily, capacity := &recorder{}, &recorder{}
+			pub := &publisher{rules: testRules, daily: daily, capacity: capacity}
+
+			rep, err := ingest(context.Background(), repo, DirSource{Root: root}, pub)
+			if err != nil {
+				t.Fatalf("ingest: %v", err)
+			}
+			if len(rep.Saved) != 2 {
+				t.Errorf("saved %v, want both days", rep.Saved)
+			}
+			if daily.count() != 2 {
+				t.Errorf("sent %d daily reports, want 2", daily.count())
+			}
+			if capacity.count() != tc.capacity {
+				t.Errorf("sent %d capacity reports, want %d", capacity.count(), tc.capacity)
+			}
+			undelivered := strings.Join(rep.Undelivered, "\n")
+			if skipped := strings.Contains(undelivered, "capacity "+days[0]+": skipped"); skipped != (tc.capacity == 0) {
+				t.Errorf("undelivered %v, capacity report skipped: %v", rep.Undelivered, skipped)
+			}
+			for _, r := range testRules {
+				want := false
+				for _, name := range tc.alerts {
+					want = want || name == r.Name
+				}
+				if strings.Contains(strings.Join(rep.Alerts, "\n"), r.Name) != want {
+					t.Errorf("alerts %v, want only %v", rep.Alerts, tc.alerts)
+				}
+			}
+		})
+	}
+}
+
+func TestIngestRequiredDatasetFails(t *testing.T) {
+	days := daysAgo(1)
+	root := writeFixtures(t, days, map[string]int{days[0]: 5}, "epidemic/cases_state.csv")
+	repo := repository.NewMemory(model.Record{Date: time.Now().AddDate(0, 0, -30).Format("2006-01-02")})
+
+	rep, err := ingest(context.Background(), repo, DirSource{Root: root}, nil)
+	if err == nil {
+		t.Fatal("ingest succeeded without cases_state.csv")
+	}
+	if len(rep.Saved) != 0 {
+		t.Errorf("saved %v", rep.Saved)
+	}
+	if _, err := repo.ByDate(context.Background(), days[0]); err != repository.ErrNotFound {
+		t.Errorf("ByDate: %v, want ErrNotFound", err)
+	}
+}
+
+func TestIngestKeepsStoredDaysWhenDatasetFails(t *testing.T) {
+	days := daysAgo(3, 2, 1)
+	repo := repository.NewMemory(model.Record{Date: time.Now().AddDate(0, 0, -30).Format("2006-01-02")})
+	root := writeFixtures(t, days[:2], map[string]int{days[0]: 5, days[1]: 6})
+	if _, err := ingest(context.Background(), repo, DirSource{Root: root}, nil); err != nil {
+		t.Fatalf("first ingest: %v", err)
+	}
+
+	// The second run revises days[0] but has no ICU data at all.
+	root = writeFixtures(t, days, map[string]int{days[0]: 50, days[1]: 6, days[2]: 7}, "epidemic/icu.csv")
+	rep, err := ingest(context.Background(), repo, DirSource{Root: root}, nil)
+	if err != nil {
+		t.Fatalf("second ingest: %v", err)
+	}
+	if got := strings.Join(rep.Saved, ","); got != days[2] {
+		t.Errorf("saved %s, want %s", got, days[2])
+	}
+	if len(rep.Revised) != 0 || len(repo.Revisions()) != 0 {
+		t.Errorf("revised %v with %d revisions while icu.csv failed", rep.Revised, len(repo.Revisions()))
+	}
+	for _, d := range days[:2] {
+		rec, err := repo.ByDate(context.Background(), d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.States["Selangor"].ICU.ICUCovid != 50 {
+			t.Errorf("%s: stored ICU covid %d, want 50", d, rec.States["Selangor"].ICU.ICUCovid)
+		}
+	}
+	if rec, _ := repo.ByDate(context.Background(), days[0]); rec.NewCases != 5 {
+		t.Errorf("%s: new cases %d, want the stored 5", days[0], rec.NewCases)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/abx123/go-covid/alerts"
+	"github.com/abx123/go-covid/model"
+	"github.com/abx123/go-covid/notify"
+	"github.com/abx123/go-covid/repository"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// publisher posts the reports for each newly stored day. A nil notifier
+// skips that report.
+type publisher struct {
+	rules    []alerts.Rule
+	daily    notify.Notifier
+	capacity notify.Notifier
+	alerts   notify.Notifier
+}
+
+// newPublisher reads the alert rules and the notification targets: the
+// daily report goes to NOTIFY_DAILY (or SLACK), the capacity report to
+// NOTIFY_CAPACITY (or SLACK_CAPACITY, then the daily targets) and alerts to
+// NOTIFY_ALERTS (or SLACK_ALERTS). See notify.FromEnv for the syntax.
+func newPublisher(ctx context.Context, db *mongo.Database) (*publisher, error) {
+	rules, err := loadRules(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("alert rules: %w", err)
+	}
+	p := &publisher{rules: rules}
+	if p.daily, err = notify.FromEnv("daily", "SLACK"); err != nil {
+		return nil, err
+	}
+	if p.capacity, err = notify.FromEnv("capacity", "SLACK_CAPACITY"); err != nil {
+		return nil, err
+	}
+	if p.capacity == nil {
+		p.capacity = p.daily
+	}
+	if p.alerts, err = notify.FromEnv("alerts", "SLACK_ALERTS"); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// publish sends the daily and capacity reports for rec and any alerts it
+// fires. Failures are recorded in rep without failing the run, since the
+// day is already stored. The capacity report, and each alert rule, is
+// skipped when a dataset it reads failed to load, since rec holds zeroes in
+// its place.
+func (p *publisher) publish(ctx context.Context, repo repository.RecordRepository, rec model.Record, rep *Report) {
+	if p == nil {
+		return
+	}
+	rec = withMetrics(ctx, repo, rec)
+	p.send(ctx, p.daily, dailyReport(rec, previous(ctx, repo, rec.Date)), rep)
+	if failed := rep.Errored(capacityDatasets...); len(failed) > 0 {
+		rep.Undelivered = append(rep.Undelivered, fmt.Sprintf("capacity %s: skipped, %s failed", rec.Date, strings.Join(failed, ", ")))
+	} else {
+		p.send(ctx, p.capacity, capacityReport(rec), rep)
+	}
+	rules := []alerts.Rule{}
+	for _, r := range p.rules {
+		if failed := rep.Errored(ruleDatasets(r)...); len(failed) > 0 && !r.Disabled {
+			rep.Undelivered = append(rep.Undelivered, fmt.Sprintf("alert %s %s: skipped, %s failed", r.Name, rec.Date, strings.Join(failed, ", ")))
+			continue
+		}
+		rules = append(rules, r)
+	}
+
+	fired, err := checkAlerts(ctx, repo, rules, rec)
+	if err != nil {
+		rep.Undelivered = append(rep.Undelivered, fmt.Sprintf("alerts %s: %s", rec.Date, err))
+		return
+	}
+	for _, a := range fired {
+		rep.Alerts = append(rep.Alerts, a.String())
+	}
+	if len(fired) == 0 {
+		return
+	}
+	if p.alerts == nil {
+		// Never fall back to the daily channel; alerts are only logged.
+		for _, a := range fired {
+			log.Println("alert:", a)
+		}
+		return
+	}
+	p.send(ctx, p.alerts, alertReport(fired), rep)
+}
+
+// previous returns the stored day before date, or nil when there is none.
+func previous(ctx context.Context, repo repository.RecordRepository, date string) *model.Record {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return nil
+	}
+	rec, err := repo.ByDate(ctx, t.AddDate(0, 0, -1).Format("2006-01-02"))
+	if err != nil {
+		return nil
+	}
+	return rec
+}
+
+func (p *publisher) send(ctx context.Context, n notify.Notifier, msg notify.Message, rep *Report) {
+	if n == nil {
+		return
+	}
+	if err := n.Notify(ctx, msg); err != nil {
+		rep.Undelivered = append(rep.Undelivered, err.Error())
+	}
+}
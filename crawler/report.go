@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// requiredDatasets are the datasets a Record cannot be built without. If any
+// of them fails to load, crawl refuses to save anything.
+var requiredDatasets = map[string]bool{
+	"epidemic/cases_malaysia.csv":  true,
+	"epidemic/cases_state.csv":     true,
+	"epidemic/deaths_malaysia.csv": true,
+	"epidemic/deaths_state.csv":    true,
+}
+
+// capacityDatasets are the optional datasets the capacity report is built
+// from. When one fails the day is stored with zeroes in its place, which
+// must not be reported as empty facilities.
+var capacityDatasets = []string{
+	"epidemic/hospital.csv",
+	"epidemic/icu.csv",
+	"epidemic/pkrc.csv",
+}
+
+// Report summarises one ingestion run.
+type Report struct {
+	Datasets []*DatasetReport `json:"datasets"`
+	Saved    []string         `json:"saved,omitempty"`
+	Revised  []string         `json:"revised,omitempty"`
+	Alerts   []string         `json:"alerts,omitempty"`
+	Errors   []string         `json:"errors,omitempty"`
+	// Undelivered lists notifications that failed after retries, or that
+	// could not be built, such as alerts whose rules failed to evaluate.
+	// They do not fail the run.
+	Undelivered []string `json:"undelivered,omitempty"`
+}
+
+type DatasetReport struct {
+	Name       string     `json:"name"`
+	Required   bool       `json:"required"`
+	Changed    bool       `json:"changed"`
+	RowsParsed int        `json:"rowsParsed"`
+	Rejected   []RowError `json:"rejected,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+type RowError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// load fetches dataset from src and decodes it into out, recording the
+// outcome in the report.
+func (r *Report) load(ctx context.Context, src Source, dataset string, out interface{}) {
+	d := &DatasetReport{Name: dataset, Required: requiredDatasets[dataset]}
+	r.Datasets = append(r.Datasets, d)
+	ds, err := src.Fetch(ctx, dataset)
+	if err != nil {
+		d.Error = err.Error()
+		return
+	}
+	d.Changed = !ds.NotModified
+	rejected, err := decodeCSV(ds.Rows, out)
+	if err != nil {
+		d.Error = err.Error()
+		return
+	}
+	d.Rejected = rejected
+	d.RowsParsed = reflect.ValueOf(out).Elem().Len()
+}
+
+// Failed returns the names of the required datasets that could not be loaded.
+func (r *Report) Failed() []string {
+	res := []string{}
+	for _, d := range r.Datasets {
+		if d.Required && d.Error != "" {
+			res = append(res, d.Name)
+		}
+	}
+	return res
+}
+
+// Errored returns which of names could not be loaded.
+func (r *Report) Errored(names ...string) []string {
+	want := map[string]bool{}
+	for _, n := range names {
+		want[n] = true
+	}
+	res := []string{}
+	for _, d := range r.Datasets {
+		if want[d.Name] && d.Error != "" {
+			res = append(res, d.Name)
+		}
+	}
+	return res
+}
+
+// Changed returns the names of the datasets whose content differs from the
+// previous run. Datasets that failed to load count as changed.
+func (r *Report) Changed() []string {
+	res := []string{}
+	for _, d := range r.Datasets {
+		if d.Changed || d.Error != "" {
+			res = append(res, d.Name)
+		}
+	}
+	return res
+}
+
+func (r *Report) String() string {
+	sb := strings.Builder{}
+	for _, d := range r.Datasets {
+		status := "unchanged"
+		if d.Changed {
+			status = "changed"
+		}
+		if d.Error != "" {
+			status = "error: " + d.Error
+		}
+		fmt.Fprintf(&sb, "%s: %d rows, %d rejected, %s\n", d.Name, d.RowsParsed, len(d.Rejected), status)
+		for _, re := range d.Rejected {
+			fmt.Fprintf(&sb, "  line %d: %s\n", re.Line, re.Error)
+		}
+	}
+	for _, a := range r.Alerts {
+		fmt.Fprintf(&sb, "alert: %s\n", a)
+	}
+	for _, e := range r.Errors {
+		fmt.Fprintf(&sb, "error: %s\n", e)
+	}
+	for _, u := range r.Undelivered {
+		fmt.Fprintf(&sb, "undelivered: %s\n", u)
+	}
+	return sb.String()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/abx123/go-covid/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const defaultRevisionWindow = 14
+
+// revisionWindow is the number of trailing days re-compared against the
+// stored records on every run, read from REVISION_WINDOW.
+func revisionWindow() int {
+	if n, err := strconv.Atoi(os.Getenv("REVISION_WINDOW")); err == nil && n >= 0 {
+		return n
+	}
+	return defaultRevisionWindow
+}
+
+// diffRecords returns one revision per field whose value differs between the
+// stored record and the freshly crawled one. Fields missing on one side are
+// reported with a nil value.
+func diffRecords(old, new model.Record, at time.Time) ([]model.Revision, error) {
+	o, err := flattenRecord(old)
+	if err != nil {
+		return nil, err
+	}
+	n, err := flattenRecord(new)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]bool{}
+	for k := range o {
+		keys[k] = true
+	}
+	for k := range n {
+		keys[k] = true
+	}
+	res := []model.Revision{}
+	for k := range keys {
+		if o[k] == n[k] {
+			continue
+		}
+		res = append(res, model.Revision{
+			Date:      new.Date,
+			Field:     k,
+			Old:       o[k],
+			New:       n[k],
+			RevisedAt: at,
+		})
+	}
+	sort.Slice(res, func(a, b int) bool {
+		return res[a].Field < res[b].Field
+	})
+	return res, nil
+}
+
+func flattenRecord(rec model.Record) (map[string]interface{}, error) {
+	rec.ID = primitive.NilObjectID
+	b, err := bson.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.M{}
+	if err := bson.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	res := map[string]interface{}{}
+	flatten("", doc, res)
+	return res, nil
+}
+
+func flatten(prefix string, doc bson.M, out map[string]interface{}) {
+	for k, v := range doc {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		if sub, ok := v.(bson.M); ok {
+			flatten(k, sub, out)
+			continue
+		}
+		out[k] = v
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/abx123/go-covid/model"
+)
+
+func TestDiffRecords(t *testing.T) {
+	at := time.Date(2021, 9, 10, 0, 0, 0, 0, time.UTC)
+	old := model.Record{
+		Date:     "2021-09-01",
+		NewCases: 10,
+		Death:    model.Death{NewDeaths: 3},
+		States:   map[string]model.State{"Selangor": {Name: "Selangor", NewCases: 4}},
+	}
+	new := old
+	new.Death = model.Death{NewDeaths: 5, BIDDeaths: 1}
+	new.States = map[string]model.State{"Selangor": {Name: "Selangor", NewCases: 4}}
+
+	revs, err := diffRecords(old, new, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, r := range revs {
+		if r.Date != "2021-09-01" || !r.RevisedAt.Equal(at) {
+			t.Errorf("revision %+v has the wrong date or time", r)
+		}
+		got = append(got, fmt.Sprintf("%s %v->%v", r.Field, r.Old, r.New))
+	}
+	want := []string{"death.bidDeaths <nil>->1", "death.newDeaths 3->5"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("revisions %v, want %v", got, want)
+	}
+
+	revs, err = diffRecords(old, old, at)
+	if err != nil || len(revs) != 0 {
+		t.Errorf("identical records: %v, %v", revs, err)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSourceURL    = "https://raw.githubusercontent.com/MoH-Malaysia/covid19-public/main"
+	defaultFetchTimeout = 30 * time.Second
+	defaultFetchRetries = 3
+	retryBackoff        = 500 * time.Millisecond
+)
+
+// Source provides the raw rows of a MoH dataset, identified by its path
+// relative to the root of the covid19-public repository, e.g.
+// "epidemic/cases_malaysia.csv".
+type Source interface {
+	Fetch(ctx context.Context, dataset string) (Dataset, error)
+}
+
+// Dataset is the content of one source file.
+type Dataset struct {
+	Rows [][]string
+	// NotModified is set when the source knows the content is identical to
+	// what the previous successful run saw.
+	NotModified bool
+}
+
+// HTTPSource reads datasets over HTTP from a covid19-public mirror. Each
+// attempt is bounded by Timeout, and failed attempts are retried up to
+// Retries times with exponential backoff. With a Cache, requests are
+// conditional on the ETag and Last-Modified of the previous response.
+type HTTPSource struct {
+	BaseURL string
+	Client  *http.Client
+	Timeout time.Duration
+	Retries int
+	Cache   FetchCache
+}
+
+func (s HTTPSource) Fetch(ctx context.Context, dataset string) (Dataset, error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var cached *CacheEntry
+	if s.Cache != nil {
+		var err error
+		cached, err = s.Cache.Get(ctx, dataset)
+		if err != nil {
+			// A broken cache only costs a full download.
+			cached = nil
+		}
+	}
+	var err error
+	for attempt := 0; attempt <= s.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return Dataset{}, ctx.Err()
+			case <-time.After(retryBackoff << uint(attempt-1)):
+			}
+		}
+		var ds Dataset
+		ds, err = s.fetchOnce(ctx, client, dataset, cached)
+		if err == nil {
+			return ds, nil
+		}
+		if !retryable(err) || ctx.Err() != nil {
+			return Dataset{}, err
+		}
+	}
+	return Dataset{}, err
+}
+
+func (s HTTPSource) fetchOnce(ctx context.Context, client *http.Client, dataset string, cached *CacheEntry) (Dataset, error) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	url := strings.TrimSuffix(s.BaseURL, "/") + "/" + dataset
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Dataset{}, err
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Dataset{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		rows, err := readCSV(bytes.NewReader(cached.Body))
+		return Dataset{Rows: rows, NotModified: true}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Dataset{}, statusError{url: url, code: resp.StatusCode}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Dataset{}, err
+	}
+	rows, err := readCSV(bytes.NewReader(body))
+	if err != nil {
+		return Dataset{}, err
+	}
+	// Servers that send no validators still get caught by the content hash.
+	hash := hashBody(body)
+	if s.Cache != nil {
+		err = s.Cache.Put(ctx, CacheEntry{
+			Dataset:      dataset,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Hash:         hash,
+			Body:         body,
+			FetchedAt:    time.Now(),
+		})
+		if err != nil {
+			return Dataset{}, err
+		}
+	}
+	return Dataset{Rows: rows, NotModified: cached != nil && cached.Hash == hash}, nil
+}
+
+// DirSource reads datasets from a local checkout of covid19-public or a
+// directory of fixtures laid out the same way.
+type DirSource struct {
+	Root string
+}
+
+func (s DirSource) Fetch(ctx context.Context, dataset string) (Dataset, error) {
+	f, err := os.Open(filepath.Join(s.Root, filepath.FromSlash(dataset)))
+	if err != nil {
+		return Dataset{}, err
+	}
+	defer f.Close()
+	rows, err := readCSV(f)
+	return Dataset{Rows: rows}, err
+}
+
+// NewSource picks a DirSource when SOURCE_DIR is set and falls back to
+// HTTP, optionally against the mirror in SOURCE_URL. FETCH_TIMEOUT (a Go
+// duration) and FETCH_RETRIES tune the HTTP source, which revalidates
+// against cache.
+func NewSource(cache FetchCache) Source {
+	if dir := os.Getenv("SOURCE_DIR"); dir != "" {
+		return DirSource{Root: dir}
+	}
+	src := HTTPSource{
+		BaseURL: defaultSourceURL,
+		Timeout: defaultFetchTimeout,
+		Retries: defaultFetchRetries,
+		Cache:   cache,
+	}
+	if url := os.Getenv("SOURCE_URL"); url != "" {
+		src.BaseURL = url
+	}
+	if d, err := time.ParseDuration(os.Getenv("FETCH_TIMEOUT")); err == nil {
+		src.Timeout = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("FETCH_RETRIES")); err == nil && n >= 0 {
+		src.Retries = n
+	}
+	return src
+}
+
+// statusError is a non-200 response from the source.
+type statusError struct {
+	url  string
+	code int
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("GET %s: %s", e.url, http.StatusText(e.code))
+}
+
+// retryable reports whether a failed fetch may succeed if tried again:
+// transport errors, timeouts, throttling and server errors. Malformed CSV is
+// not worth retrying.
+func retryable(err error) bool {
+	switch e := err.(type) {
+	case statusError:
+		return e.code == http.StatusTooManyRequests || e.code >= 500
+	case *csv.ParseError:
+		return false
+	}
+	return true
+}
+
+// readCSV reads every row. Rows with the wrong number of fields are kept,
+// so decodeCSV can reject them one by one instead of losing the file.
+func readCSV(r io.Reader) ([][]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	data, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
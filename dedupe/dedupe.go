@@ -0,0 +1,95 @@
+// Package dedupe remembers which deliveries have already been handled, so a
+// retried delivery of the same event is acknowledged without acting twice.
+package dedupe
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultTTL is how long an ID is remembered. Slack gives up retrying an
+// event well within an hour.
+const DefaultTTL = time.Hour
+
+// Store records processed IDs for a limited time.
+type Store interface {
+	// Claim marks id as processed and reports whether this was the first
+	// claim within the TTL. Only the caller that gets true should act.
+	Claim(ctx context.Context, id string) (bool, error)
+}
+
+var (
+	_ Store = (*Mongo)(nil)
+	_ Store = (*Memory)(nil)
+)
+
+// Mongo keeps one document per ID, expired by a TTL index on "at". MongoDB
+// removes expired documents in the background, about once a minute.
+type Mongo struct {
+	coll *mongo.Collection
+	ttl  time.Duration
+}
+
+func NewMongo(coll *mongo.Collection, ttl time.Duration) *Mongo {
+	return &Mongo{coll: coll, ttl: ttl}
+}
+
+// EnsureIndexes creates the TTL index. Changing the TTL of an existing
+// index needs it dropped first.
+func (m *Mongo) EnsureIndexes(ctx context.Context) error {
+	_, err := m.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(m.ttl.Seconds())),
+	})
+	return err
+}
+
+// Claim relies on the unique _id, so concurrent claims of one ID cannot both
+// succeed.
+func (m *Mongo) Claim(ctx context.Context, id string) (bool, error) {
+	_, err := m.coll.InsertOne(ctx, bson.M{"_id": id, "at": time.Now()})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Memory is a Store held in process memory, for tests and local runs.
+type Memory struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	now  func() time.Time
+	seen map[string]time.Time
+}
+
+// NewMemory returns a Memory store. now defaults to time.Now.
+func NewMemory(ttl time.Duration, now func() time.Time) *Memory {
+	if now == nil {
+		now = time.Now
+	}
+	return &Memory{ttl: ttl, now: now, seen: map[string]time.Time{}}
+}
+
+func (m *Memory) Claim(ctx context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	for k, at := range m.seen {
+		if now.Sub(at) >= m.ttl {
+			delete(m.seen, k)
+		}
+	}
+	if _, ok := m.seen[id]; ok {
+		return false, nil
+	}
+	m.seen[id] = now
+	return true, nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/abx123/go-covid/states"
+)
+
+// fieldPath is one path from the fields= parameter, resolved against the
+// type being returned.
+type fieldPath struct {
+	// json walks the response. "*" matches every key of a map, so
+	// "states.newCases" keeps newCases for every state.
+	json []string
+	// bson is what to project in Mongo. State names contain dots, which
+	// cannot appear in a projection, so paths into states stop at "states".
+	// It is empty when the whole record is needed.
+	bson string
+	// derived is set for paths into the computed derived block.
+	derived bool
+}
+
+type fields []fieldPath
+
+// parseFields resolves a comma-separated list of dotted JSON paths, such as
+// "newCases,death.newDeaths,states.kl.icu", against t. A segment under
+// states is either a state (any alias states.Normalize accepts) or a State
+// field to keep for every state.
+func parseFields(raw string, t reflect.Type) (fields, error) {
+	res := fields{}
+	for _, p := range strings.Split(raw, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		f, err := resolve(strings.Split(p, "."), t)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, f)
+	}
+	return res, nil
+}
+
+func resolve(segs []string, t reflect.Type) (fieldPath, error) {
+	res := fieldPath{}
+	bsonPath := []string{}
+	inMap := false
+	for i, seg := range segs {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			f, ok := jsonField(t, seg)
+			if !ok {
+				return res, badRequest("unknown field %q", strings.Join(segs[:i+1], "."))
+			}
+			res.json = append(res.json, seg)
+			if f.Tag.Get("bson") == "-" {
+				// Derived values are computed from the whole record
+				// rather than loaded.
+				res.derived = true
+				if !inMap {
+					bsonPath = nil
+				}
+				inMap = true
+			}
+			if !inMap {
+				bsonPath = append(bsonPath, bsonName(f))
+			}
+			t = f.Type
+		case reflect.Map:
+			inMap = true
+			if f, ok := jsonField(t.Elem(), seg); ok {
+				res.json = append(res.json, "*", seg)
+				t = f.Type
+				continue
+			}
+			name, ok := states.Normalize(seg)
+			if !ok {
+				return res, badRequest("unknown state or field %q", strings.Join(segs[:i+1], "."))
+			}
+			res.json = append(res.json, name)
+			t = t.Elem()
+		default:
+			return res, badRequest("field %q has no subfields", strings.Join(segs[:i], "."))
+		}
+	}
+	res.bson = strings.Join(bsonPath, ".")
+	return res, nil
+}
+
+// jsonField finds the field of struct type t that encodes as name,
+// descending into embedded structs the way encoding/json does.
+func jsonField(t reflect.Type, name string) (reflect.StructField, bool) {
+	if t.Kind() != reflect.Struct {
+		return reflect.StructField{}, false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if f.Anonymous && tag == "" {
+			if ef, ok := jsonField(f.Type, name); ok {
+				return ef, true
+			}
+			continue
+		}
+		if tag == "-" || f.PkgPath != "" {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		if tag == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// bsonName is the key the Mongo driver stores f under.
+func bsonName(f reflect.StructField) string {
+	if tag := strings.Split(f.Tag.Get("bson"), ",")[0]; tag != "" {
+		return tag
+	}
+	return strings.ToLower(f.Name)
+}
+
+// projection is the list of BSON paths to load from the repository, or nil
+// to load whole records. Paths already covered by an ancestor are dropped,
+// since MongoDB rejects a projection holding both as a path collision.
+func (fs fields) projection() []string {
+	paths := map[string]bool{}
+	for _, f := range fs {
+		if f.bson == "" {
+			return nil
+		}
+		paths[f.bson] = true
+	}
+	res := []string{}
+	for p := range paths {
+		covered := false
+		for q := range paths {
+			if strings.HasPrefix(p, q+".") {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			res = append(res, p)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// columns lists the CSV columns for rows of type t: the dotted path of every
+// leaf, or only those under fs when fields were asked for. Maps are keyed by
+// state, so every state gets its columns whether or not it reported that
+// day. date comes first and the rest are sorted.
+func (fs fields) columns(t reflect.Type) []string {
+	all := [][]string{}
+	leaves(nil, t, &all)
+	res := []string{}
+	hasDate := false
+	for _, path := range all {
+		col := strings.Join(path, ".")
+		if col == "date" {
+			hasDate = true
+			continue
+		}
+		if fs.covers(path) {
+			res = append(res, col)
+		}
+	}
+	sort.Strings(res)
+	if hasDate {
+		res = append([]string{"date"}, res...)
+	}
+	return res
+}
+
+// covers reports whether path is one of fs or lies under one. Empty fs
+// covers everything.
+func (fs fields) covers(path []string) bool {
+	if len(fs) == 0 {
+		return true
+	}
+	for _, f := range fs {
+		if len(f.json) > len(path) {
+			continue
+		}
+		match := true
+		for i, seg := range f.json {
+			if seg != "*" && seg != path[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// leaves appends the JSON path of every value in t that is not itself an
+// object, walking into structs, pointers to structs and the states map.
+func leaves(prefix []string, t reflect.Type, out *[][]string) {
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := strings.Split(f.Tag.Get("json"), ",")[0]
+			if f.Anonymous && tag == "" {
+				leaves(prefix, f.Type, out)
+				continue
+			}
+			if tag == "-" || f.PkgPath != "" {
+				continue
+			}
+			if tag == "" {
+				tag = f.Name
+			}
+			leaves(append(prefix[:len(prefix):len(prefix)], tag), f.Type, out)
+		}
+	case reflect.Map:
+		for _, name := range states.Names {
+			leaves(append(prefix[:len(prefix):len(prefix)], name), t.Elem(), out)
+		}
+	default:
+		*out = append(*out, prefix)
+	}
+}
+
+// derived reports whether the response needs derived metrics, which is
+// always the case when no fields were asked for.
+func (fs fields) derived() bool {
+	if len(fs) == 0 {
+		return true
+	}
+	for _, f := range fs {
+		if f.derived {
+			return true
+		}
+	}
+	return false
+}
+
+// trim re-encodes v keeping only date and the requested paths. v is a
+// single object or a slice of them.
+func (fs fields) trim(v interface{}) (interface{}, error) {
+	doc, err := generic(v)
+	if err != nil {
+		return nil, err
+	}
+	if list, ok := doc.([]interface{}); ok {
+		res := make([]interface{}, len(list))
+		for i, el := range list {
+			res[i] = fs.pick(el)
+		}
+		return res, nil
+	}
+	return fs.pick(doc), nil
+}
+
+func (fs fields) pick(doc interface{}) interface{} {
+	src, ok := doc.(map[string]interface{})
+	if !ok {
+		return doc
+	}
+	dst := map[string]interface{}{}
+	if date, ok := src["date"]; ok {
+		dst["date"] = date
+	}
+	for _, f := range fs {
+		copyPath(dst, src, f.json)
+	}
+	return dst
+}
+
+// copyPath copies the value at path in src into dst, creating the objects
+// along the way. Paths missing from src, such as derived values that could
+// not be computed, are skipped.
+func copyPath(dst, src map[string]interface{}, path []string) {
+	keys := []string{path[0]}
+	if path[0] == "*" {
+		keys = keys[:0]
+		for k := range src {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range keys {
+		v, ok := src[k]
+		if !ok {
+			continue
+		}
+		if len(path) == 1 {
+			dst[k] = v
+			continue
+		}
+		sub, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		next, ok := dst[k].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			dst[k] = next
+		}
+		copyPath(next, sub, path[1:])
+	}
+}
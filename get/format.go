@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	formatJSON   = "json"
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+)
+
+var contentTypes = map[string]string{
+	formatJSON:   "application/json",
+	formatCSV:    "text/csv; charset=utf-8",
+	formatNDJSON: "application/x-ndjson",
+}
+
+// negotiate picks the output format from the format= parameter, falling back
+// to the first Accept media type we can produce, then JSON.
+func negotiate(request events.APIGatewayProxyRequest) (string, error) {
+	if f, ok := request.QueryStringParameters["format"]; ok {
+		f = strings.ToLower(f)
+		if _, ok := contentTypes[f]; !ok {
+			return "", badRequest("unknown format %q, want json, csv or ndjson", f)
+		}
+		return f, nil
+	}
+	for k, v := range request.Headers {
+		if !strings.EqualFold(k, "Accept") {
+			continue
+		}
+		for _, mt := range strings.Split(v, ",") {
+			mt = strings.TrimSpace(strings.Split(mt, ";")[0])
+			switch strings.ToLower(mt) {
+			case "application/json":
+				return formatJSON, nil
+			case "text/csv":
+				return formatCSV, nil
+			case "application/x-ndjson", "application/ndjson":
+				return formatNDJSON, nil
+			}
+		}
+	}
+	return formatJSON, nil
+}
+
+// encode renders res, a single object or a slice of them, in format. cols
+// are the CSV columns.
+func encode(res interface{}, format string, cols []string) (string, error) {
+	switch format {
+	case formatCSV:
+		return encodeCSV(res, cols)
+	case formatNDJSON:
+		return encodeNDJSON(res)
+	}
+	return formatResp(res), nil
+}
+
+// generic re-decodes v as plain maps and slices, keeping numbers as written.
+func generic(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var res interface{}
+	if err := d.Decode(&res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// rows returns res as a list of records, wrapping a single one.
+func rows(res interface{}) ([]interface{}, error) {
+	doc, err := generic(res)
+	if err != nil {
+		return nil, err
+	}
+	if list, ok := doc.([]interface{}); ok {
+		return list, nil
+	}
+	return []interface{}{doc}, nil
+}
+
+func encodeNDJSON(res interface{}) (string, error) {
+	list, err := rows(res)
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	for _, r := range list {
+		if err := enc.Encode(r); err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
+}
+
+// encodeCSV writes one row per record under the header cols. Nested fields
+// are dotted column names, such as "death.newDeaths" or
+// "states.Selangor.icu.icuCovid". A record without a value for a column,
+// such as a state that did not report, gets an empty cell.
+func encodeCSV(res interface{}, cols []string) (string, error) {
+	list, err := rows(res)
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	w := csv.NewWriter(buf)
+	w.Write(cols)
+	for _, r := range list {
+		flat := map[string]string{}
+		flattenJSON("", r, flat)
+		row := make([]string, len(cols))
+		for i, k := range cols {
+			row[i] = flat[k]
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	return buf.String(), w.Error()
+}
+
+func flattenJSON(prefix string, v interface{}, out map[string]string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, sub := range v {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+			flattenJSON(k, sub, out)
+		}
+	case nil:
+	default:
+		out[prefix] = fmt.Sprint(v)
+	}
+}
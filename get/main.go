@@ -4,114 +4,26 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"reflect"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"github.com/abx123/go-covid/metrics"
+	"github.com/abx123/go-covid/model"
+	"github.com/abx123/go-covid/repository"
+	"github.com/abx123/go-covid/states"
+
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type Record struct {
-	ID                primitive.ObjectID `bson:"_id,omitempty"`
-	Date              string             `bson:"date,omitempty"`
-	NewCases          int                `bson:"newCases,omitempty"`
-	ImportCases       int                `bson:"importCases,omitempty"`
-	RecoveredCases    int                `bson:"recoveredCases,omitempty"`
-	ClusterImport     int                `bson:"importClusters,omitempty"`
-	ClusterReligious  int                `bson:"religiousClusters,omitempty"`
-	ClusterCommunity  int                `bson:"communityClusters,omitempty"`
-	ClusterHighRisk   int                `bson:"HighRiskClusters,omitempty"`
-	ClusterEducation  int                `bson:"educationClusters,omitempty"`
-	ClusterDentention int                `bson:"detentionClusters,omitempty"`
-	ClusterWorkplace  int                `bson:"workspaceClusters,omitempty"`
-	States            map[string]State   `bson:"states,omitempty"`
-	Death             Death              `bson:"death,omitempty"`
-	Test              Test               `bson:"tests,omitempty"`
-	Population        Population         `bson:"population,omitempty"`
-}
-
-type Population struct {
-	Population int `bson:"population,omitempty"`
-	Over18     int `bson:"over18,omitempty"`
-	Over60     int `bson:"over60,omitempty"`
-	Over12     int `bson:"over12,omitempty"`
-}
-
-type Test struct {
-	RtkAg int `bson:"rtkAg,omitempty"`
-	Pcr   int `bson:"Pcr,omitempty"`
-}
-
-type State struct {
-	ImportCases    int        `bson:"importCases,omitempty"`
-	NewCases       int        `bson:"newCases,omitempty"`
-	RecoveredCases int        `bson:"recoveredCases,omitempty"`
-	Death          Death      `bson:"death,omitempty"`
-	Hospital       Hospital   `bson:"hospital,omitempty"`
-	ICU            ICU        `bson:"icu,omitempty"`
-	PKRC           PKRC       `bson:"pkrc,omitempty"`
-	Test           Test       `bson:"test,omitempty"`
-	Population     Population `bson:"population,omitempty"`
-}
-
-type Hospital struct {
-	Beds                 int `bson:"beds,omitempty"`
-	CovidBeds            int `bson:"covidBeds,omitempty"`
-	NonCriticalBeds      int `bson:"nonCriticalBeds,omitempty"`
-	AdmittedPUI          int `bson:"admittedPui,omitempty"`
-	AdmittedCovid        int `bson:"admittedCovid,omitempty"`
-	AdmittedTotal        int `bson:"admittedTotal,omitempty"`
-	DischargedPui        int `bson:"dischargedPui,omitempty"`
-	DischargedCovid      int `bson:"dischargedCovid,omitempty"`
-	DischargedTotal      int `bson:"dischargedTotal,omitempty"`
-	HospitalizedCovid    int `bson:"hospitalizedCovid,omitempty"`
-	HospitalizedPui      int `bson:"hospitalizedPui,omitempty"`
-	HospitalizedNonCovid int `bson:"hospitalizedNonCovid,omitempty"`
-}
-
-type Death struct {
-	NewDeaths       int `bson:"newDeaths,omitempty"`
-	ActualDeaths    int `bson:"actualDeaths,omitempty"`
-	BIDDeaths       int `bson:"bidDeaths,omitempty"`
-	ActualBIDDeaths int `bson:"actualBidDeaths,omitempty"`
-}
-
-type ICU struct {
-	ICUBeds             int `bson:"icuBeds,omitempty"`
-	ICUBedsRep          int `bson:"iceBedsRep,omitempty"`
-	ICUBedsTotal        int `bson:"icuBedsTotal,omitempty"`
-	ICUBedsCovid        int `bson:"icuBedsCovid,omitempty"`
-	Ventilators         int `bson:"ventilators,omitempty"`
-	PortableVentilators int `bson:"portableVentilators,omitempty"`
-	ICUCovid            int `bson:"icuCovid,omitempty"`
-	ICUPui              int `bson:"icuPui,omitempty"`
-	ICUNonCovid         int `bson:"icuNonCovid,omitempty"`
-	VentCovid           int `bson:"ventilatorsCovid,omitempty"`
-	VentPui             int `bson:"ventilatorsPui,omitempty"`
-	VentNonCovid        int `bson:"ventilatorsNonCovid,omitempty"`
-	VentUsed            int `bson:"ventilatorsUsed,omitempty"`
-	PortVentUsed        int `bson:"portableVentilatorsUsed,omitempty"`
-}
-
-type PKRC struct {
-	Beds            int `bson:"beds,omitempty"`
-	AdmittedCovid   int `bson:"admittedCovid,omitempty"`
-	AdmittedPui     int `bson:"admittedPui,omitempty"`
-	AdmittedTotal   int `bson:"admittedTotal,omitempty"`
-	DischargedPui   int `bson:"dischargedPui,omitempty"`
-	DischargedCovid int `bson:"dischargedCovid,omitempty"`
-	DischargedTotal int `bson:"dischargedTotal,omitempty"`
-	PKRCCovid       int `bson:"pkrcCovid,omitempty"`
-	PKRCPui         int `bson:"pkrcPui,omitempty"`
-	PKRCNonCovid    int `bson:"pkrcNonCovid,omitempty"`
-}
-
 // func main() {
 // 	get(context.TODO(), events.APIGatewayProxyRequest{})
 // }
@@ -120,62 +32,261 @@ func main() {
 	lambda.Start(get)
 }
 
-func getFromMongo(collection *mongo.Collection, date string) (*Record, error) {
-	res := &Record{}
-	opt := options.FindOne()
-	opt.SetSort(bson.M{"date": -1})
-	filter := bson.M{}
-	if date != "" {
-		filter = bson.M{"date": date}
-	}
-	err := collection.FindOne(context.TODO(), filter, opt).Decode(res)
-	if err != nil {
-		return nil, err
+// getRecord returns the record for date, or the latest one when date is
+// empty.
+func getRecord(ctx context.Context, repo repository.RecordRepository, date string, fields ...string) (*model.Record, error) {
+	if date == "" {
+		return repo.Latest(ctx, fields...)
 	}
-	return res, nil
+	return repo.ByDate(ctx, date, fields...)
 }
 
 func get(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	headers := map[string]string{
-		"Access-Control-Allow-Headers": "Content-Type",
-		"Access-Control-Allow-Origin":  "*",
-		"Access-Control-Allow-Methods": "GET",
+	client, err := NewMongoClient()
+	if err != nil {
+		log.Println("connect:", err)
+		return respondError(&apiError{status: http.StatusServiceUnavailable, msg: "database unavailable"})
 	}
-	client, _ := NewMongoClient()
 	defer client.Disconnect(context.Background())
-	collection := client.Database("covid").Collection("my")
+	return handle(ctx, repository.NewMongo(client.Database("covid")), request)
+}
+
+// maxRangeDays caps how many daily records one range query may return.
+const maxRangeDays = 366
+
+var headers = map[string]string{
+	"Access-Control-Allow-Headers": "Content-Type",
+	"Access-Control-Allow-Origin":  "*",
+	"Access-Control-Allow-Methods": "GET",
+	"Content-Type":                 "application/json",
+}
+
+func respond(status int, body string) (events.APIGatewayProxyResponse, error) {
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    headers,
+		Body:       body,
+	}, nil
+}
+
+// respondAs is respond with a Content-Type other than JSON.
+func respondAs(status int, contentType, body string) (events.APIGatewayProxyResponse, error) {
+	h := make(map[string]string, len(headers))
+	for k, v := range headers {
+		h[k] = v
+	}
+	h["Content-Type"] = contentType
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    h,
+		Body:       body,
+	}, nil
+}
+
+// apiError is an error with the HTTP status it should be reported as.
+type apiError struct {
+	status int
+	msg    string
+}
 
-	var rec *Record
-	var err error
-	date := ""
-	if val, ok := request.PathParameters["date"]; ok {
-		rec, err = getFromMongo(collection, val)
+func (e *apiError) Error() string {
+	return e.msg
+}
+
+func badRequest(format string, a ...interface{}) error {
+	return &apiError{status: http.StatusBadRequest, msg: fmt.Sprintf(format, a...)}
+}
+
+func notFound(format string, a ...interface{}) error {
+	return &apiError{status: http.StatusNotFound, msg: fmt.Sprintf(format, a...)}
+}
+
+// errorBody is the envelope every error response is wrapped in:
+//
+//	{"error": {"status": 404, "code": "not_found", "message": "no data for 2021-09-09"}}
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusNotFound:            "not_found",
+	http.StatusInternalServerError: "internal",
+	http.StatusServiceUnavailable:  "unavailable",
+}
+
+// toAPIError maps err onto the status it should be reported as. Unexpected
+// errors are logged and reported without their details.
+func toAPIError(err error) *apiError {
+	if ae, ok := err.(*apiError); ok {
+		return ae
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return &apiError{status: http.StatusNotFound, msg: "no data"}
+	}
+	log.Println(err)
+	if errors.Is(err, repository.ErrUnavailable) {
+		return &apiError{status: http.StatusServiceUnavailable, msg: "database unavailable"}
+	}
+	return &apiError{status: http.StatusInternalServerError, msg: "internal error"}
+}
+
+func respondError(err error) (events.APIGatewayProxyResponse, error) {
+	ae := toAPIError(err)
+	return respond(ae.status, formatResp(errorBody{Error: errorDetail{
+		Status:  ae.status,
+		Code:    errorCodes[ae.status],
+		Message: ae.msg,
+	}}))
+}
+
+// stateRecord is one day of a single state's data.
+type stateRecord struct {
+	Date string `json:"date"`
+	model.State
+}
+
+func handle(ctx context.Context, repo repository.RecordRepository, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	format, err := negotiate(request)
+	if err != nil {
+		return respondError(err)
+	}
+	res, cols, err := route(ctx, repo, request)
+	if err != nil {
+		return respondError(err)
+	}
+	body, err := encode(res, format, cols)
+	if err != nil {
+		return respondError(err)
+	}
+	return respondAs(http.StatusOK, contentTypes[format], body)
+}
+
+// route serves /, /{date}, /records/{id}, /states/{state} and
+// /states/{state}/{date}. Any of them takes from/to query parameters
+// instead of a date to return a range, and fields= to return only some
+// fields. The body is JSON unless format= or Accept asks for csv or ndjson.
+func route(ctx context.Context, repo repository.RecordRepository, request events.APIGatewayProxyRequest) (interface{}, []string, error) {
+	state := ""
+	if val, ok := request.PathParameters["state"]; ok {
+		name, ok := states.Normalize(val)
+		if !ok {
+			return nil, nil, notFound("unknown state %q", val)
+		}
+		state = name
+	}
+
+	typ := reflect.TypeOf(model.Record{})
+	if state != "" {
+		typ = reflect.TypeOf(stateRecord{})
+	}
+	fs, err := parseFields(request.QueryStringParameters["fields"], typ)
+	if err != nil {
+		return nil, nil, err
+	}
+	proj := fs.projection()
+	if state != "" && len(fs) > 0 {
+		proj = []string{"states"}
+	}
+
+	res, err := find(ctx, repo, request, state, proj, fs.derived())
+	if err != nil || len(fs) == 0 {
+		return res, fs.columns(typ), err
+	}
+	res, err = fs.trim(res)
+	return res, fs.columns(typ), err
+}
+
+// find loads what route asked for, projecting proj from the repository.
+// With derive set, the derived metrics are filled in as well.
+func find(ctx context.Context, repo repository.RecordRepository, request events.APIGatewayProxyRequest, state string, proj []string, derive bool) (interface{}, error) {
+	_, hasFrom := request.QueryStringParameters["from"]
+	_, hasTo := request.QueryStringParameters["to"]
+	if hasFrom || hasTo {
+		recs, err := getRange(ctx, repo, request.QueryStringParameters["from"], request.QueryStringParameters["to"], proj...)
+		if err == nil && derive {
+			err = metrics.Load(ctx, repo, recs, proj...)
+		}
+		if err != nil || state == "" {
+			return recs, err
+		}
+		res := []stateRecord{}
+		for _, rec := range recs {
+			if s, ok := rec.States[state]; ok {
+				res = append(res, stateRecord{Date: rec.Date, State: s})
+			}
+		}
+		return res, nil
+	}
+
+	date := request.PathParameters["date"]
+	if val, ok := request.PathParameters["id"]; ok {
+		d, err := model.DateFromID(val)
+		if err != nil {
+			return nil, badRequest("%s", err)
+		}
+		date = d
+	}
+	if date != "" {
+		if _, err := parseDate(date); err != nil {
+			return nil, err
+		}
+	}
+	rec, err := getRecord(ctx, repo, date, proj...)
+	if err == repository.ErrNotFound && date != "" {
+		return nil, notFound("no data for %s", date)
+	}
+	if err == nil && derive {
+		err = metrics.Load(ctx, repo, []*model.Record{rec}, proj...)
+	}
+	if err != nil || state == "" {
+		return rec, err
+	}
+	s, ok := rec.States[state]
+	if !ok {
+		return nil, notFound("no data for %s on %s", state, rec.Date)
+	}
+	return stateRecord{Date: rec.Date, State: s}, nil
+}
+
+// getRange returns the daily records from from to to inclusive, oldest
+// first. to defaults to today.
+func getRange(ctx context.Context, repo repository.RecordRepository, from, to string, fields ...string) ([]*model.Record, error) {
+	if from == "" {
+		return nil, badRequest("from is required")
+	}
+	f, err := parseDate(from)
+	if err != nil {
+		return nil, err
+	}
+	t := time.Now().UTC().Truncate(24 * time.Hour)
+	if to != "" {
+		t, err = parseDate(to)
 		if err != nil {
-			return events.APIGatewayProxyResponse{
-				StatusCode: http.StatusInternalServerError,
-				Headers:    headers,
-				Body:       err.Error(),
-			}, nil
+			return nil, err
 		}
-		return events.APIGatewayProxyResponse{
-			StatusCode: http.StatusOK,
-			Headers:    headers,
-			Body:       formatResp(rec),
-		}, nil
 	}
-	rec, err = getFromMongo(collection, date)
+	if t.Before(f) {
+		return nil, badRequest("to is before from")
+	}
+	if days := int(t.Sub(f).Hours()/24) + 1; days > maxRangeDays {
+		return nil, badRequest("range of %d days exceeds the maximum of %d", days, maxRangeDays)
+	}
+	return repo.Range(ctx, f.Format("2006-01-02"), t.Format("2006-01-02"), fields...)
+}
+
+func parseDate(s string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", s)
 	if err != nil {
-		return events.APIGatewayProxyResponse{
-			StatusCode: http.StatusInternalServerError,
-			Headers:    headers,
-			Body:       err.Error(),
-		}, nil
+		return time.Time{}, badRequest("invalid date %q, want YYYY-MM-DD", s)
 	}
-	return events.APIGatewayProxyResponse{
-		StatusCode: http.StatusOK,
-		Headers:    headers,
-		Body:       formatResp(rec),
-	}, nil
+	return t, nil
 }
 
 func formatResp(input interface{}) string {
@@ -192,14 +303,22 @@ func formatResp(input interface{}) string {
 	return formattedResp
 }
 
+// dbTimeout bounds server selection for the connection and every query, so
+// an unreachable database is answered with a 503 well before API Gateway
+// gives up on the request at 29 seconds.
+const dbTimeout = 5 * time.Second
+
 func NewMongoClient() (*mongo.Client, error) {
-	clientOptions := options.Client().ApplyURI(os.Getenv("MONGO"))
+	clientOptions := options.Client().ApplyURI(os.Getenv("MONGO")).SetServerSelectionTimeout(dbTimeout)
 	client, err := mongo.Connect(context.TODO(), clientOptions)
 	if err != nil {
 		return nil, err
 	}
-	err = client.Ping(context.TODO(), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	err = client.Ping(ctx, nil)
 	if err != nil {
+		client.Disconnect(context.Background())
 		return nil, err
 	}
 	return client, err
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abx123/go-covid/model"
+	"github.com/abx123/go-covid/repository"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// testRepo holds 2021-09-01 to 2021-09-20, with Selangor reporting a tenth
+// of the national cases.
+func testRepo() *repository.Memory {
+	recs := []model.Record{}
+	for d := 1; d <= 20; d++ {
+		recs = append(recs, model.Record{
+			Date:     fmt.Sprintf("2021-09-%02d", d),
+			NewCases: 100 * d,
+			Death:    model.Death{NewDeaths: d},
+			States: map[string]model.State{
+				"Selangor":          {Name: "Selangor", NewCases: 10 * d},
+				"W.P. Kuala Lumpur": {Name: "W.P. Kuala Lumpur", NewCases: d},
+			},
+		})
+	}
+	return repository.NewMemory(recs...)
+}
+
+// unavailable fails every read as if MongoDB were down.
+type unavailable struct {
+	repository.RecordRepository
+}
+
+func (unavailable) Latest(ctx context.Context, fields ...string) (*model.Record, error) {
+	return nil, repository.ErrUnavailable
+}
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    map[string]string
+		query   map[string]string
+		headers map[string]string
+		status  int
+		// contains must all appear in the body.
+		contains []string
+	}{
+		{name: "latest", status: 200, contains: []string{`"date": "2021-09-20"`, `"newCases": 2000`, `"derived"`}},
+		{name: "by date", path: map[string]string{"date": "2021-09-05"}, status: 200, contains: []string{`"newCases": 500`}},
+		{name: "bad date", path: map[string]string{"date": "5 sep"}, status: 400, contains: []string{`"code": "bad_request"`}},
+		{name: "missing date", path: map[string]string{"date": "2020-01-01"}, status: 404, contains: []string{`"code": "not_found"`}},
+		{name: "state alias", path: map[string]string{"state": "kl", "date": "2021-09-03"}, status: 200, contains: []string{`"name": "W.P. Kuala Lumpur"`, `"newCases": 3`}},
+		{name: "unknown state", path: map[string]string{"state": "atlantis"}, status: 404},
+		{name: "state range", path: map[string]string{"state": "selangor"}, query: map[string]string{"from": "2021-09-01", "to": "2021-09-02"}, status: 200, contains: []string{`"newCases": 10`, `"newCases": 20`}},
+		{name: "range", query: map[string]string{"from": "2021-09-18", "to": "2021-09-19"}, status: 200, contains: []string{`"2021-09-18"`, `"2021-09-19"`}},
+		{name: "fields", query: map[string]string{"fields": "newCases,death.newDeaths,states.sel.newCases"}, status: 200, contains: []string{`"newDeaths": 20`, `"Selangor"`}},
+		{name: "unknown field", query: map[string]string{"fields": "nope"}, status: 400},
+		{name: "csv", query: map[string]string{"from": "2021-09-19", "to": "2021-09-20", "fields": "newCases"}, headers: map[string]string{"accept": "text/csv"}, status: 200, contains: []string{"date,newCases\n2021-09-19,1900\n2021-09-20,2000\n"}},
+		{name: "csv zeroes", query: map[string]string{"from": "2021-09-20", "fields": "death.bidDeaths", "format": "csv", "to": "2021-09-20"}, status: 200, contains: []string{"date,death.bidDeaths\n2021-09-20,0\n"}},
+		{name: "ndjson", query: map[string]string{"from": "2021-09-19", "to": "2021-09-20", "fields": "newCases", "format": "ndjson"}, status: 200, contains: []string{`{"date":"2021-09-19","newCases":1900}` + "\n"}},
+		{name: "unknown format", query: map[string]string{"format": "xml"}, status: 400},
+		{name: "backwards range", query: map[string]string{"from": "2021-09-19", "to": "2021-09-18"}, status: 400},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := handle(context.Background(), testRepo(), events.APIGatewayProxyRequest{
+				PathParameters:        tc.path,
+				QueryStringParameters: tc.query,
+				Headers:               tc.headers,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tc.status {
+				t.Errorf("status %d, want %d\n%s", res.StatusCode, tc.status, res.Body)
+			}
+			for _, s := range tc.contains {
+				if !strings.Contains(res.Body, s) {
+					t.Errorf("body does not contain %q\n%s", s, res.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleUnavailable(t *testing.T) {
+	res, err := handle(context.Background(), unavailable{testRepo()}, events.APIGatewayProxyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want 503", res.StatusCode)
+	}
+	body := errorBody{}
+	if err := json.Unmarshal([]byte(res.Body), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error.Code != "unavailable" {
+		t.Errorf("code %q, want unavailable", body.Error.Code)
+	}
+}
+
+func TestProjection(t *testing.T) {
+	tests := []struct {
+		fields string
+		want   []string
+	}{
+		{"newCases", []string{"newCases"}},
+		{"death,death.newDeaths", []string{"death"}},
+		{"death.newDeaths,death.bidDeaths,newCases,newCases", []string{"death.newDeaths", "death.bidDeaths", "newCases"}},
+		{"derived.newCasesAvg7", nil},
+	}
+	for _, tc := range tests {
+		fs, err := parseFields(tc.fields, reflect.TypeOf(model.Record{}))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.fields, err)
+		}
+		got := fs.projection()
+		if tc.want == nil {
+			if got != nil {
+				t.Errorf("%s: projection %v, want whole records", tc.fields, got)
+			}
+			continue
+		}
+		want := map[string]bool{}
+		for _, w := range tc.want {
+			want[w] = true
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s: projection %v, want %v", tc.fields, got, tc.want)
+		}
+		for _, g := range got {
+			if !want[g] {
+				t.Errorf("%s: projection %v, want %v", tc.fields, got, tc.want)
+			}
+		}
+	}
+}
+
+// TestCSVColumns checks that the header depends only on what was asked for,
+// not on which values happen to be present.
+func TestCSVColumns(t *testing.T) {
+	header := func(query map[string]string, path map[string]string) (string, string) {
+		t.Helper()
+		query["format"] = "csv"
+		res, err := handle(context.Background(), testRepo(), events.APIGatewayProxyRequest{PathParameters: path, QueryStringParameters: query})
+		if err != nil || res.StatusCode != 200 {
+			t.Fatalf("status %d, %v\n%s", res.StatusCode, err, res.Body)
+		}
+		lines := strings.SplitN(res.Body, "\n", 3)
+		return lines[0], lines[1]
+	}
+
+	h1, row := header(map[string]string{"from": "2021-09-01", "to": "2021-09-02"}, nil)
+	h2, _ := header(map[string]string{}, map[string]string{"date": "2021-09-20"})
+	if h1 != h2 {
+		t.Errorf("headers differ between queries:\n%s\n%s", h1, h2)
+	}
+	cols := strings.Split(h1, ",")
+	if cols[0] != "date" {
+		t.Errorf("first column %q, want date", cols[0])
+	}
+	cells := strings.Split(row, ",")
+	for i, c := range cols {
+		switch c {
+		case "death.bidDeaths":
+			if cells[i] != "0" {
+				t.Errorf("%s = %q, want 0", c, cells[i])
+			}
+		case "states.Johor.newCases":
+			// Johor has no data in testRepo.
+			if cells[i] != "" {
+				t.Errorf("%s = %q, want an empty cell", c, cells[i])
+			}
+		}
+	}
+	for _, want := range []string{"death.bidDeaths", "states.Johor.newCases", "states.Selangor.icu.icuCovid", "derived.newCasesAvg7"} {
+		found := false
+		for _, c := range cols {
+			found = found || c == want
+		}
+		if !found {
+			t.Errorf("no %s column", want)
+		}
+	}
+
+	h3, _ := header(map[string]string{"fields": "newCases", "from": "2021-09-01", "to": "2021-09-02"}, map[string]string{"state": "sel"})
+	if h3 != "date,newCases" {
+		t.Errorf("state header %q, want date,newCases", h3)
+	}
+}
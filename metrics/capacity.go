@@ -0,0 +1,127 @@
+package metrics
+
+import "github.com/abx123/go-covid/model"
+
+// Utilization levels, in percent, at which capacity is reported as a warning
+// or as critical.
+const (
+	WarnUtilization     = 70
+	CriticalUtilization = 90
+)
+
+// Level is how serious a utilization percentage is.
+type Level int
+
+const (
+	LevelOK Level = iota
+	LevelWarn
+	LevelCritical
+)
+
+// LevelOf classifies pct, treating a missing value as OK.
+func LevelOf(pct *float64) Level {
+	switch {
+	case pct == nil:
+		return LevelOK
+	case *pct >= CriticalUtilization:
+		return LevelCritical
+	case *pct >= WarnUtilization:
+		return LevelWarn
+	}
+	return LevelOK
+}
+
+// WorstLevel is the most serious level of any utilization in c.
+func WorstLevel(c *model.Capacity) Level {
+	res := LevelOK
+	if c == nil {
+		return res
+	}
+	for _, v := range []*float64{c.CovidBeds, c.Beds, c.ICUCovid, c.ICU, c.Ventilators, c.PKRC} {
+		if l := LevelOf(v); l > res {
+			res = l
+		}
+	}
+	return res
+}
+
+// facilities are the counts utilization is computed from, summed across
+// states for the national roll-up.
+type facilities struct {
+	covidBeds, hospCovid   int
+	beds, hospTotal        int
+	icuBedsCovid, icuCovid int
+	icuBedsTotal, icuTotal int
+	vents, ventsUsed       int
+	pkrcBeds, pkrcOccupied int
+}
+
+func stateFacilities(s model.State) facilities {
+	return facilities{
+		covidBeds:    s.Hospital.CovidBeds,
+		hospCovid:    s.Hospital.HospitalizedCovid,
+		beds:         s.Hospital.Beds,
+		hospTotal:    s.Hospital.HospitalizedCovid + s.Hospital.HospitalizedPui + s.Hospital.HospitalizedNonCovid,
+		icuBedsCovid: s.ICU.ICUBedsCovid,
+		icuCovid:     s.ICU.ICUCovid,
+		icuBedsTotal: s.ICU.ICUBedsTotal,
+		icuTotal:     s.ICU.ICUCovid + s.ICU.ICUPui + s.ICU.ICUNonCovid,
+		vents:        s.ICU.Ventilators + s.ICU.PortableVentilators,
+		ventsUsed:    s.ICU.VentUsed + s.ICU.PortVentUsed,
+		pkrcBeds:     s.PKRC.Beds,
+		pkrcOccupied: s.PKRC.PKRCCovid + s.PKRC.PKRCPui + s.PKRC.PKRCNonCovid,
+	}
+}
+
+func (f *facilities) add(o facilities) {
+	f.covidBeds += o.covidBeds
+	f.hospCovid += o.hospCovid
+	f.beds += o.beds
+	f.hospTotal += o.hospTotal
+	f.icuBedsCovid += o.icuBedsCovid
+	f.icuCovid += o.icuCovid
+	f.icuBedsTotal += o.icuBedsTotal
+	f.icuTotal += o.icuTotal
+	f.vents += o.vents
+	f.ventsUsed += o.ventsUsed
+	f.pkrcBeds += o.pkrcBeds
+	f.pkrcOccupied += o.pkrcOccupied
+}
+
+// capacity returns nil when no facility data was reported at all.
+func (f facilities) capacity() *model.Capacity {
+	c := &model.Capacity{
+		CovidBeds:   utilization(f.hospCovid, f.covidBeds),
+		Beds:        utilization(f.hospTotal, f.beds),
+		ICUCovid:    utilization(f.icuCovid, f.icuBedsCovid),
+		ICU:         utilization(f.icuTotal, f.icuBedsTotal),
+		Ventilators: utilization(f.ventsUsed, f.vents),
+		PKRC:        utilization(f.pkrcOccupied, f.pkrcBeds),
+	}
+	if *c == (model.Capacity{}) {
+		return nil
+	}
+	return c
+}
+
+func utilization(used, available int) *float64 {
+	if available <= 0 {
+		return nil
+	}
+	return round(100 * float64(used) / float64(available))
+}
+
+// Capacity returns the utilization of one state's facilities.
+func Capacity(s model.State) *model.Capacity {
+	return stateFacilities(s).capacity()
+}
+
+// NationalCapacity rolls the facilities of every state in rec up into one
+// national utilization. MoH does not publish national facility counts.
+func NationalCapacity(rec *model.Record) *model.Capacity {
+	f := facilities{}
+	for _, s := range rec.States {
+		f.add(stateFacilities(s))
+	}
+	return f.capacity()
+}
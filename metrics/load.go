@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/abx123/go-covid/model"
+	"github.com/abx123/go-covid/repository"
+)
+
+// Load runs Annotate on recs, consecutive days in date order, after loading
+// the Lookback days before the first of them from repo. fields is passed on
+// to Range as its projection. On error recs are left without Derived.
+func Load(ctx context.Context, repo repository.RecordRepository, recs []*model.Record, fields ...string) error {
+	if len(recs) == 0 {
+		return nil
+	}
+	t, err := time.Parse("2006-01-02", recs[0].Date)
+	if err != nil {
+		return err
+	}
+	prev, err := repo.Range(ctx, t.AddDate(0, 0, -Lookback).Format("2006-01-02"), t.AddDate(0, 0, -1).Format("2006-01-02"), fields...)
+	if err != nil {
+		return err
+	}
+	Annotate(append(prev, recs...))
+	return nil
+}
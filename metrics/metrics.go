@@ -0,0 +1,189 @@
+// Package metrics derives the figures usually quoted about a day, such as
+// rolling averages, test positivity, per-capita rates and healthcare
+// capacity utilization, from the stored daily Records.
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/abx123/go-covid/model"
+)
+
+// Lookback is how many days before a record Annotate needs in order to fill
+// in every derived value. Callers should load that many extra days.
+const Lookback = 13
+
+// window is the 14 days ending at a record, today first. A missing day is a
+// zero point with ok unset.
+type window [Lookback + 1]point
+
+type point struct {
+	ok     bool
+	cases  int
+	deaths int
+	tests  int
+	pop    int
+}
+
+// Annotate sets Derived on every record in recs and on each of their
+// states. Days before the first record are treated as missing, so the
+// first Lookback records of a series only get the values their window
+// covers.
+func Annotate(recs []*model.Record) {
+	byDate := make(map[string]*model.Record, len(recs))
+	for _, r := range recs {
+		byDate[r.Date] = r
+	}
+	for _, r := range recs {
+		days, err := history(byDate, r.Date)
+		if err != nil {
+			continue
+		}
+		r.Derived = derive(collect(days, national))
+		r.Derived.Capacity = NationalCapacity(r)
+		if len(r.States) == 0 {
+			continue
+		}
+		states := make(map[string]model.State, len(r.States))
+		for name, s := range r.States {
+			s.Derived = derive(collect(days, byState(name)))
+			s.Derived.Capacity = Capacity(s)
+			states[name] = s
+		}
+		r.States = states
+	}
+}
+
+// history returns the records for date and the Lookback days before it,
+// most recent first, with nil for days that are not in byDate.
+func history(byDate map[string]*model.Record, date string) ([]*model.Record, error) {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*model.Record, Lookback+1)
+	for i := range res {
+		res[i] = byDate[t.AddDate(0, 0, -i).Format("2006-01-02")]
+	}
+	return res, nil
+}
+
+func collect(days []*model.Record, at func(*model.Record) point) window {
+	w := window{}
+	for i, r := range days {
+		if r != nil {
+			w[i] = at(r)
+		}
+	}
+	return w
+}
+
+func national(r *model.Record) point {
+	return point{
+		ok:     true,
+		cases:  r.NewCases,
+		deaths: r.Death.NewDeaths,
+		tests:  r.Test.RtkAg + r.Test.Pcr,
+		pop:    r.Population.Population,
+	}
+}
+
+func byState(name string) func(*model.Record) point {
+	return func(r *model.Record) point {
+		s, ok := r.States[name]
+		if !ok {
+			return point{}
+		}
+		return point{
+			ok:     true,
+			cases:  s.NewCases,
+			deaths: s.Death.NewDeaths,
+			tests:  s.Test.RtkAg + s.Test.Pcr,
+			pop:    s.Population.Population,
+		}
+	}
+}
+
+func derive(w window) *model.Derived {
+	d := &model.Derived{}
+	cases := func(p point) int { return p.cases }
+	deaths := func(p point) int { return p.deaths }
+	d.NewCasesAvg7 = avg(w, 0, 7, cases)
+	d.NewCasesAvg14 = avg(w, 0, 14, cases)
+	d.NewDeathsAvg7 = avg(w, 0, 7, deaths)
+	d.NewDeathsAvg14 = avg(w, 0, 14, deaths)
+	d.CasesWeekOverWeek = change(avg(w, 7, 7, cases), d.NewCasesAvg7)
+	d.DeathsWeekOverWeek = change(avg(w, 7, 7, deaths), d.NewDeathsAvg7)
+
+	today := w[0]
+	if !today.ok {
+		return d
+	}
+	if today.tests > 0 {
+		d.PositivityRate = round(100 * float64(today.cases) / float64(today.tests))
+	}
+	if today.pop > 0 {
+		d.CasesPer100k = round(1e5 * float64(today.cases) / float64(today.pop))
+		d.DeathsPer100k = round(1e5 * float64(today.deaths) / float64(today.pop))
+	}
+	return d
+}
+
+// avg is the mean of n days starting from the from-th most recent, or nil
+// if any of them is missing.
+func avg(w window, from, n int, v func(point) int) *float64 {
+	sum := 0
+	for _, p := range w[from : from+n] {
+		if !p.ok {
+			return nil
+		}
+		sum += v(p)
+	}
+	return round(float64(sum) / float64(n))
+}
+
+// change is the percentage change from prev to cur.
+func change(prev, cur *float64) *float64 {
+	if prev == nil || cur == nil || *prev == 0 {
+		return nil
+	}
+	return round(100 * (*cur - *prev) / *prev)
+}
+
+// round keeps two decimal places.
+func round(f float64) *float64 {
+	f = math.Round(f*100) / 100
+	return &f
+}
+
+// Text renders d as lines in the style of the Slack daily messages. Values
+// that could not be derived are shown as n/a.
+func Text(d *model.Derived) string {
+	if d == nil {
+		return ""
+	}
+	return fmt.Sprintf(" 7-day Avg Cases: %s \n 14-day Avg Cases: %s \n 7-day Avg Deaths: %s \n Cases Week-over-Week: %s \n Deaths Week-over-Week: %s \n Test Positivity: %s \n Cases per 100k: %s \n Deaths per 100k: %s \n",
+		num(d.NewCasesAvg7), num(d.NewCasesAvg14), num(d.NewDeathsAvg7),
+		pct(d.CasesWeekOverWeek, true), pct(d.DeathsWeekOverWeek, true),
+		pct(d.PositivityRate, false), num(d.CasesPer100k), num(d.DeathsPer100k))
+}
+
+func num(f *float64) string {
+	if f == nil {
+		return "n/a"
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+func pct(f *float64, signed bool) string {
+	if f == nil {
+		return "n/a"
+	}
+	if signed && *f > 0 {
+		return "+" + num(f) + "%"
+	}
+	return num(f) + "%"
+}
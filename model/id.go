@@ -0,0 +1,37 @@
+package model
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IDFromDate derives the primary key of the Record for a YYYY-MM-DD date. The
+// ObjectID timestamp is midnight UTC of that day and every other byte is
+// zero, so a day always maps to the same ID and IDs sort by date.
+func IDFromDate(date string) (primitive.ObjectID, error) {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	id := primitive.ObjectID{}
+	binary.BigEndian.PutUint32(id[0:4], uint32(t.Unix()))
+	return id, nil
+}
+
+// DateFromID is the inverse of IDFromDate. It rejects IDs that were not
+// derived from a date.
+func DateFromID(hex string) (string, error) {
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return "", err
+	}
+	for _, b := range id[4:] {
+		if b != 0 {
+			return "", fmt.Errorf("%s is not a date-derived id", hex)
+		}
+	}
+	return id.Timestamp().UTC().Format("2006-01-02"), nil
+}
@@ -0,0 +1,189 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SchemaVersion is the layout version of the Record documents written by the
+// crawler. Bump it whenever a field is renamed or its meaning changes.
+const SchemaVersion = 1
+
+type Record struct {
+	ID                primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	SchemaVersion     int                `json:"schemaVersion" bson:"schemaVersion,omitempty"`
+	Date              string             `json:"date" bson:"date,omitempty"`
+	NewCases          int                `json:"newCases" bson:"newCases,omitempty"`
+	ImportCases       int                `json:"importCases" bson:"importCases,omitempty"`
+	RecoveredCases    int                `json:"recoveredCases" bson:"recoveredCases,omitempty"`
+	ActiveCases       int                `json:"activeCases" bson:"activeCases,omitempty"`
+	ClusterCases      int                `json:"clusterCases" bson:"clusterCases,omitempty"`
+	PVax              int                `json:"partiallyVaccinatedCases" bson:"partiallyVaccinatedCases,omitempty"`
+	FVax              int                `json:"fullyVaccinatedCases" bson:"fullyVaccinatedCases,omitempty"`
+	ChildCases        int                `json:"childCases" bson:"childCases,omitempty"`
+	AdolescentCases   int                `json:"adolescentCases" bson:"adolescentCases,omitempty"`
+	AdultCases        int                `json:"adultCases" bson:"adultCases,omitempty"`
+	ElderlyCases      int                `json:"elderlyCases" bson:"elderlyCases,omitempty"`
+	ClusterImport     int                `json:"importClusters" bson:"importClusters,omitempty"`
+	ClusterReligious  int                `json:"religiousClusters" bson:"religiousClusters,omitempty"`
+	ClusterCommunity  int                `json:"communityClusters" bson:"communityClusters,omitempty"`
+	ClusterHighRisk   int                `json:"highRiskClusters" bson:"HighRiskClusters,omitempty"`
+	ClusterEducation  int                `json:"educationClusters" bson:"educationClusters,omitempty"`
+	ClusterDentention int                `json:"detentionClusters" bson:"detentionClusters,omitempty"`
+	ClusterWorkplace  int                `json:"workplaceClusters" bson:"workspaceClusters,omitempty"`
+	States            map[string]State   `json:"states" bson:"states,omitempty"`
+	Death             Death              `json:"death" bson:"death,omitempty"`
+	Test              Test               `json:"tests" bson:"tests,omitempty"`
+	Population        Population         `json:"population" bson:"population,omitempty"`
+	Vaccination       Vaccination        `json:"vaccination" bson:"vaccination,omitempty"`
+	Derived           *Derived           `json:"derived,omitempty" bson:"-"`
+}
+
+type Population struct {
+	Population int `json:"population" bson:"population,omitempty"`
+	Over18     int `json:"over18" bson:"over18,omitempty"`
+	Over60     int `json:"over60" bson:"over60,omitempty"`
+	Over12     int `json:"over12" bson:"over12,omitempty"`
+}
+
+type Test struct {
+	RtkAg int `json:"rtkAg" bson:"rtkAg,omitempty"`
+	Pcr   int `json:"pcr" bson:"Pcr,omitempty"`
+}
+
+type State struct {
+	Name            string      `json:"name" bson:"Name,omitempty"`
+	ImportCases     int         `json:"importCases" bson:"importCases,omitempty"`
+	NewCases        int         `json:"newCases" bson:"newCases,omitempty"`
+	RecoveredCases  int         `json:"recoveredCases" bson:"recoveredCases,omitempty"`
+	ActiveCases     int         `json:"activeCases" bson:"activeCases,omitempty"`
+	ClusterCases    int         `json:"clusterCases" bson:"clusterCases,omitempty"`
+	PVax            int         `json:"partiallyVaccinatedCases" bson:"partiallyVaccinatedCases,omitempty"`
+	FVax            int         `json:"fullyVaccinatedCases" bson:"fullyVaccinatedCases,omitempty"`
+	ChildCases      int         `json:"childCases" bson:"childCases,omitempty"`
+	AdolescentCases int         `json:"adolescentCases" bson:"adolescentCases,omitempty"`
+	AdultCases      int         `json:"adultCases" bson:"adultCases,omitempty"`
+	ElderlyCases    int         `json:"elderlyCases" bson:"elderlyCases,omitempty"`
+	Death           Death       `json:"death" bson:"death,omitempty"`
+	Hospital        Hospital    `json:"hospital" bson:"hospital,omitempty"`
+	ICU             ICU         `json:"icu" bson:"icu,omitempty"`
+	PKRC            PKRC        `json:"pkrc" bson:"pkrc,omitempty"`
+	Test            Test        `json:"test" bson:"test,omitempty"`
+	Population      Population  `json:"population" bson:"population,omitempty"`
+	Vaccination     Vaccination `json:"vaccination" bson:"vaccination,omitempty"`
+	Derived         *Derived    `json:"derived,omitempty" bson:"-"`
+}
+
+type Hospital struct {
+	Beds                 int `json:"beds" bson:"beds,omitempty"`
+	CovidBeds            int `json:"covidBeds" bson:"covidBeds,omitempty"`
+	NonCriticalBeds      int `json:"nonCriticalBeds" bson:"nonCriticalBeds,omitempty"`
+	AdmittedPUI          int `json:"admittedPui" bson:"admittedPui,omitempty"`
+	AdmittedCovid        int `json:"admittedCovid" bson:"admittedCovid,omitempty"`
+	AdmittedTotal        int `json:"admittedTotal" bson:"admittedTotal,omitempty"`
+	DischargedPui        int `json:"dischargedPui" bson:"dischargedPui,omitempty"`
+	DischargedCovid      int `json:"dischargedCovid" bson:"dischargedCovid,omitempty"`
+	DischargedTotal      int `json:"dischargedTotal" bson:"dischargedTotal,omitempty"`
+	HospitalizedCovid    int `json:"hospitalizedCovid" bson:"hospitalizedCovid,omitempty"`
+	HospitalizedPui      int `json:"hospitalizedPui" bson:"hospitalizedPui,omitempty"`
+	HospitalizedNonCovid int `json:"hospitalizedNonCovid" bson:"hospitalizedNonCovid,omitempty"`
+}
+
+type Death struct {
+	NewDeaths       int `json:"newDeaths" bson:"newDeaths,omitempty"`
+	ActualDeaths    int `json:"actualDeaths" bson:"actualDeaths,omitempty"`
+	BIDDeaths       int `json:"bidDeaths" bson:"bidDeaths,omitempty"`
+	ActualBIDDeaths int `json:"actualBidDeaths" bson:"actualBidDeaths,omitempty"`
+	PVaxDeaths      int `json:"partiallyVaccinatedDeaths" bson:"partiallyVaccinatedDeaths,omitempty"`
+	FVaxDeaths      int `json:"fullyVaccinatedDeaths" bson:"FullyVaccinatedDeaths,omitempty"`
+}
+
+type ICU struct {
+	ICUBeds             int `json:"icuBeds" bson:"icuBeds,omitempty"`
+	ICUBedsRep          int `json:"icuBedsRep" bson:"iceBedsRep,omitempty"`
+	ICUBedsTotal        int `json:"icuBedsTotal" bson:"icuBedsTotal,omitempty"`
+	ICUBedsCovid        int `json:"icuBedsCovid" bson:"icuBedsCovid,omitempty"`
+	Ventilators         int `json:"ventilators" bson:"ventilators,omitempty"`
+	PortableVentilators int `json:"portableVentilators" bson:"portableVentilators,omitempty"`
+	ICUCovid            int `json:"icuCovid" bson:"icuCovid,omitempty"`
+	ICUPui              int `json:"icuPui" bson:"icuPui,omitempty"`
+	ICUNonCovid         int `json:"icuNonCovid" bson:"icuNonCovid,omitempty"`
+	VentCovid           int `json:"ventilatorsCovid" bson:"ventilatorsCovid,omitempty"`
+	VentPui             int `json:"ventilatorsPui" bson:"ventilatorsPui,omitempty"`
+	VentNonCovid        int `json:"ventilatorsNonCovid" bson:"ventilatorsNonCovid,omitempty"`
+	VentUsed            int `json:"ventilatorsUsed" bson:"ventilatorsUsed,omitempty"`
+	PortVentUsed        int `json:"portableVentilatorsUsed" bson:"portableVentilatorsUsed,omitempty"`
+}
+
+type PKRC struct {
+	Beds            int `json:"beds" bson:"beds,omitempty"`
+	AdmittedCovid   int `json:"admittedCovid" bson:"admittedCovid,omitempty"`
+	AdmittedPui     int `json:"admittedPui" bson:"admittedPui,omitempty"`
+	AdmittedTotal   int `json:"admittedTotal" bson:"admittedTotal,omitempty"`
+	DischargedPui   int `json:"dischargedPui" bson:"dischargedPui,omitempty"`
+	DischargedCovid int `json:"dischargedCovid" bson:"dischargedCovid,omitempty"`
+	DischargedTotal int `json:"dischargedTotal" bson:"dischargedTotal,omitempty"`
+	PKRCCovid       int `json:"pkrcCovid" bson:"pkrcCovid,omitempty"`
+	PKRCPui         int `json:"pkrcPui" bson:"pkrcPui,omitempty"`
+	PKRCNonCovid    int `json:"pkrcNonCovid" bson:"pkrcNonCovid,omitempty"`
+}
+
+// Vaccination is one day of the national immunisation programme rollout.
+// Daily counts are doses administered on the day; Cumul counts are running
+// totals up to and including the day.
+type Vaccination struct {
+	DailyPartial      int   `json:"dailyPartial" bson:"dailyPartial,omitempty"`
+	DailyFull         int   `json:"dailyFull" bson:"dailyFull,omitempty"`
+	DailyBooster      int   `json:"dailyBooster" bson:"dailyBooster,omitempty"`
+	Daily             int   `json:"daily" bson:"daily,omitempty"`
+	DailyPartialChild int   `json:"dailyPartialChild" bson:"dailyPartialChild,omitempty"`
+	DailyFullChild    int   `json:"dailyFullChild" bson:"dailyFullChild,omitempty"`
+	CumulPartial      int   `json:"cumulPartial" bson:"cumulPartial,omitempty"`
+	CumulFull         int   `json:"cumulFull" bson:"cumulFull,omitempty"`
+	CumulBooster      int   `json:"cumulBooster" bson:"cumulBooster,omitempty"`
+	Cumul             int   `json:"cumul" bson:"cumul,omitempty"`
+	CumulPartialChild int   `json:"cumulPartialChild" bson:"cumulPartialChild,omitempty"`
+	CumulFullChild    int   `json:"cumulFullChild" bson:"cumulFullChild,omitempty"`
+	Pfizer            Doses `json:"pfizer" bson:"pfizer,omitempty"`
+	Sinovac           Doses `json:"sinovac" bson:"sinovac,omitempty"`
+	AstraZeneca       Doses `json:"astraZeneca" bson:"astraZeneca,omitempty"`
+	Sinopharm         Doses `json:"sinopharm" bson:"sinopharm,omitempty"`
+	Cansino           Doses `json:"cansino" bson:"cansino,omitempty"`
+	Pending           Doses `json:"pending" bson:"pending,omitempty"`
+}
+
+// Doses are the daily doses of one vaccine brand by dose number. Single-dose
+// brands such as CanSino only fill Dose1 and the booster Dose3.
+type Doses struct {
+	Dose1 int `json:"dose1" bson:"dose1,omitempty"`
+	Dose2 int `json:"dose2" bson:"dose2,omitempty"`
+	Dose3 int `json:"dose3" bson:"dose3,omitempty"`
+}
+
+// Derived holds figures computed from a day and the days before it. They are
+// filled in on read by the metrics package and never stored. A value is nil
+// when the data it needs is missing, such as a 7-day average over a window
+// with gaps or a positivity rate on a day without test counts.
+type Derived struct {
+	NewCasesAvg7       *float64  `json:"newCasesAvg7,omitempty"`
+	NewCasesAvg14      *float64  `json:"newCasesAvg14,omitempty"`
+	NewDeathsAvg7      *float64  `json:"newDeathsAvg7,omitempty"`
+	NewDeathsAvg14     *float64  `json:"newDeathsAvg14,omitempty"`
+	PositivityRate     *float64  `json:"positivityRate,omitempty"`
+	CasesPer100k       *float64  `json:"casesPer100k,omitempty"`
+	DeathsPer100k      *float64  `json:"deathsPer100k,omitempty"`
+	CasesWeekOverWeek  *float64  `json:"casesWeekOverWeek,omitempty"`
+	DeathsWeekOverWeek *float64  `json:"deathsWeekOverWeek,omitempty"`
+	Capacity           *Capacity `json:"capacity,omitempty"`
+}
+
+// Capacity is how full the healthcare facilities are, as percentages of the
+// beds or ventilators available. On a Record it is the roll-up of every
+// state.
+type Capacity struct {
+	CovidBeds   *float64 `json:"covidBeds,omitempty"`
+	Beds        *float64 `json:"beds,omitempty"`
+	ICUCovid    *float64 `json:"icuCovid,omitempty"`
+	ICU         *float64 `json:"icu,omitempty"`
+	Ventilators *float64 `json:"ventilators,omitempty"`
+	PKRC        *float64 `json:"pkrc,omitempty"`
+}
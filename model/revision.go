@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// Revision records one field of a stored Record that MoH later revised.
+// Field is the dotted BSON path of the value, e.g. "states.Selangor.death.newDeaths".
+type Revision struct {
+	Date      string      `json:"date" bson:"date"`
+	Field     string      `json:"field" bson:"field"`
+	Old       interface{} `json:"old" bson:"old"`
+	New       interface{} `json:"new" bson:"new"`
+	RevisedAt time.Time   `json:"revisedAt" bson:"revisedAt"`
+}
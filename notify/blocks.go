@@ -0,0 +1,68 @@
+package notify
+
+// Block is one Slack Block Kit layout block. Only the fields the block type
+// uses are set; the constructors below build the ones we post.
+type Block struct {
+	Type     string `json:"type"`
+	Text     *Text  `json:"text,omitempty"`
+	Fields   []Text `json:"fields,omitempty"`
+	Elements []Text `json:"elements,omitempty"`
+}
+
+// Text is a Block Kit text object.
+type Text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Block Kit limits, in characters or items.
+const (
+	headerLimit  = 150
+	sectionLimit = 3000
+	fieldLimit   = 2000
+	maxFields    = 10
+)
+
+func mrkdwn(s string, limit int) Text {
+	return Text{Type: "mrkdwn", Text: truncate(s, limit)}
+}
+
+func Header(s string) Block {
+	return Block{Type: "header", Text: &Text{Type: "plain_text", Text: truncate(s, headerLimit)}}
+}
+
+func Section(s string) Block {
+	t := mrkdwn(s, sectionLimit)
+	return Block{Type: "section", Text: &t}
+}
+
+// Fields lays out fields two to a row, as many sections as it takes.
+func Fields(fields ...string) []Block {
+	res := []Block{}
+	for len(fields) > 0 {
+		n := len(fields)
+		if n > maxFields {
+			n = maxFields
+		}
+		b := Block{Type: "section"}
+		for _, f := range fields[:n] {
+			b.Fields = append(b.Fields, mrkdwn(f, fieldLimit))
+		}
+		res = append(res, b)
+		fields = fields[n:]
+	}
+	return res
+}
+
+func Divider() Block {
+	return Block{Type: "divider"}
+}
+
+// Context is small grey text under the blocks above it.
+func Context(s ...string) Block {
+	b := Block{Type: "context"}
+	for _, e := range s {
+		b.Elements = append(b.Elements, mrkdwn(e, fieldLimit))
+	}
+	return b
+}
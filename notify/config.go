@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetries = 3
+	defaultBackoff = time.Second
+	defaultTimeout = 10 * time.Second
+)
+
+// FromEnv builds the notifier for one purpose, such as "daily" or "alerts",
+// from NOTIFY_<NAME>: a comma-separated list of targets, each one of
+//
+//	slack:<incoming webhook URL>
+//	slack-text:<URL>          a Slack-compatible webhook without Block Kit
+//	slack-api:<channel>       posted as the bot, with SLACK_TOKEN
+//	discord:<webhook URL>
+//	telegram:<chat id>        with TELEGRAM_TOKEN
+//	webhook:<URL>             the Message as JSON
+//
+// A bare URL is taken as a Slack incoming webhook. When NOTIFY_<NAME> is
+// unset, the URL in the legacy variable is used instead, if any. The result
+// is nil when nothing is configured.
+//
+// Each target is retried NOTIFY_RETRIES times (default 3) and every request
+// is bounded by NOTIFY_TIMEOUT (a Go duration, default 10s).
+func FromEnv(name, legacy string) (Notifier, error) {
+	cfg := os.Getenv("NOTIFY_" + strings.ToUpper(name))
+	if cfg == "" && legacy != "" {
+		cfg = os.Getenv(legacy)
+	}
+	if cfg == "" {
+		return nil, nil
+	}
+	retries := defaultRetries
+	if n, err := strconv.Atoi(os.Getenv("NOTIFY_RETRIES")); err == nil && n >= 0 {
+		retries = n
+	}
+	client := &http.Client{Timeout: defaultTimeout}
+	if d, err := time.ParseDuration(os.Getenv("NOTIFY_TIMEOUT")); err == nil {
+		client.Timeout = d
+	}
+
+	res := Multi{}
+	for _, target := range strings.Split(cfg, ",") {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		n, err := parseTarget(target, client)
+		if err != nil {
+			return nil, fmt.Errorf("NOTIFY_%s: %w", strings.ToUpper(name), err)
+		}
+		kind := strings.SplitN(target, ":", 2)[0]
+		if strings.HasPrefix(kind, "http") {
+			kind = "slack"
+		}
+		res = append(res, Retry{Notifier: n, Name: name + " " + kind, Attempts: retries + 1, Backoff: defaultBackoff})
+	}
+	if len(res) == 1 {
+		return res[0], nil
+	}
+	return res, nil
+}
+
+func parseTarget(target string, client *http.Client) (Notifier, error) {
+	if strings.HasPrefix(target, "https://") || strings.HasPrefix(target, "http://") {
+		return &SlackWebhook{URL: target, Client: client}, nil
+	}
+	parts := strings.SplitN(target, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("invalid target %q", target)
+	}
+	kind, arg := parts[0], parts[1]
+	switch kind {
+	case "slack":
+		return &SlackWebhook{URL: arg, Client: client}, nil
+	case "slack-text":
+		return &SlackWebhook{URL: arg, TextOnly: true, Client: client}, nil
+	case "slack-api":
+		token := os.Getenv("SLACK_TOKEN")
+		if token == "" {
+			return nil, fmt.Errorf("slack-api target needs SLACK_TOKEN")
+		}
+		return &SlackAPI{Token: token, Channel: arg, Client: client}, nil
+	case "discord":
+		return &Discord{URL: arg, Client: client}, nil
+	case "telegram":
+		token := os.Getenv("TELEGRAM_TOKEN")
+		if token == "" {
+			return nil, fmt.Errorf("telegram target needs TELEGRAM_TOKEN")
+		}
+		return &Telegram{Token: token, ChatID: arg, Client: client}, nil
+	case "webhook":
+		return &Webhook{URL: arg, Client: client}, nil
+	}
+	return nil, fmt.Errorf("unknown target kind %q", kind)
+}
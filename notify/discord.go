@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// discordLimit is the most characters Discord accepts in a message's content.
+const discordLimit = 2000
+
+// Discord posts to a Discord channel webhook. Attachments become embeds.
+type Discord struct {
+	URL    string
+	Client *http.Client
+}
+
+type discordPost struct {
+	Content string         `json:"content"`
+	Embeds  []discordEmbed `json:"embeds,omitempty"`
+}
+
+type discordEmbed struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Color       int    `json:"color,omitempty"`
+}
+
+func (d *Discord) Notify(ctx context.Context, msg Message) error {
+	post := discordPost{Content: truncate(msg.Text, discordLimit)}
+	for _, a := range msg.Attachments {
+		color, _ := strconv.ParseInt(strings.TrimPrefix(a.Color, "#"), 16, 32)
+		post.Embeds = append(post.Embeds, discordEmbed{Title: a.Title, Description: a.Text, Color: int(color)})
+	}
+	// Discord rejects more than ten embeds, so the rest go in the content.
+	if len(post.Embeds) > 10 {
+		post.Embeds = post.Embeds[:10]
+		post.Content = truncate(Message{Text: msg.Text, Attachments: msg.Attachments[10:]}.PlainText(), discordLimit)
+	}
+	return postJSON(ctx, d.Client, d.URL, nil, post, nil)
+}
+
+// truncate cuts s to at most n characters, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
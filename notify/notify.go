@@ -0,0 +1,183 @@
+// Package notify delivers messages to chat services. Each service implements
+// Notifier; which ones a binary posts to is chosen from the environment with
+// FromEnv.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Message is what gets posted. Text is always sent; targets that cannot show
+// attachments append them to the text instead. Blocks are a Slack Block Kit
+// layout of the same content: Slack shows them in place of Text, and every
+// other target ignores them, so Text must stand on its own.
+type Message struct {
+	Text        string       `json:"text"`
+	Blocks      []Block      `json:"blocks,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment is a coloured block of text, such as one state's figures.
+// Color is a #rrggbb hex string.
+type Attachment struct {
+	Color    string `json:"color,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Fallback string `json:"fallback,omitempty"`
+}
+
+// PlainText renders m as text alone, for targets without attachments.
+func (m Message) PlainText() string {
+	sb := strings.Builder{}
+	sb.WriteString(m.Text)
+	for _, a := range m.Attachments {
+		sb.WriteString("\n\n")
+		if a.Title != "" {
+			sb.WriteString(a.Title + "\n")
+		}
+		sb.WriteString(a.Text)
+	}
+	return sb.String()
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Multi posts to every notifier in turn, returning the errors of those that
+// failed joined into one.
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, msg Message) error {
+	errs := []string{}
+	for _, n := range m {
+		if err := n.Notify(ctx, msg); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Retry retries transient delivery failures, such as timeouts, 429s and
+// 5xx responses, with exponential backoff starting at Backoff.
+type Retry struct {
+	Notifier Notifier
+	Name     string
+	Attempts int
+	Backoff  time.Duration
+}
+
+func (r Retry) Notify(ctx context.Context, msg Message) error {
+	wait := r.Backoff
+	var err error
+	for i := 0; i < r.Attempts || i == 0; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%s: %w", r.Name, ctx.Err())
+			case <-time.After(wait):
+			}
+			wait *= 2
+		}
+		if err = r.Notifier.Notify(ctx, msg); err == nil || !retryable(err) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", r.Name, err)
+	}
+	return nil
+}
+
+// statusError is a response with an unexpected HTTP status.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.code, e.body)
+}
+
+// apiError is a failure reported in the body of a 200 response, as the Slack
+// and Telegram APIs do.
+type apiError struct {
+	msg       string
+	temporary bool
+}
+
+func (e *apiError) Error() string {
+	return e.msg
+}
+
+func retryable(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code == http.StatusTooManyRequests || se.code >= 500
+	}
+	var ae *apiError
+	if errors.As(err, &ae) {
+		return ae.temporary
+	}
+	// Anything else failed before a response arrived.
+	return true
+}
+
+// postJSON posts body to target and decodes the response into out, when out
+// is not nil. Errors never include target, since webhook URLs and the
+// Telegram API path carry credentials.
+func postJSON(ctx context.Context, client *http.Client, target string, header http.Header, body, out interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(b))
+	if err != nil {
+		return withoutURL(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return withoutURL(err)
+	}
+	defer resp.Body.Close()
+	res, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{code: resp.StatusCode, body: strings.TrimSpace(string(res))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(res, out)
+}
+
+// withoutURL drops the request URL a *url.Error carries in its message,
+// keeping the operation and the underlying error.
+func withoutURL(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		return fmt.Errorf("%s: %w", ue.Op, ue.Err)
+	}
+	return err
+}
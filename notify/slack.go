@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+)
+
+// SlackWebhook posts to a Slack incoming webhook, which is tied to one
+// channel. TextOnly drops Block Kit blocks, for Slack-compatible webhooks
+// such as Mattermost's that do not render them.
+type SlackWebhook struct {
+	URL      string
+	TextOnly bool
+	Client   *http.Client
+}
+
+func (s *SlackWebhook) Notify(ctx context.Context, msg Message) error {
+	if s.TextOnly {
+		msg.Blocks = nil
+	}
+	return postJSON(ctx, s.Client, s.URL, nil, msg, nil)
+}
+
+const slackAPI = "https://slack.com/api"
+
+// SlackAPI posts with the Web API's chat.postMessage as a bot user, which
+// can reach any channel the bot is in.
+type SlackAPI struct {
+	Token   string
+	Channel string
+	// BaseURL defaults to https://slack.com/api.
+	BaseURL string
+	Client  *http.Client
+}
+
+type slackPost struct {
+	Channel string `json:"channel"`
+	Message
+}
+
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+func (s *SlackAPI) Notify(ctx context.Context, msg Message) error {
+	base := s.BaseURL
+	if base == "" {
+		base = slackAPI
+	}
+	header := http.Header{"Authorization": {"Bearer " + s.Token}}
+	res := slackResponse{}
+	if err := postJSON(ctx, s.Client, base+"/chat.postMessage", header, slackPost{Channel: s.Channel, Message: msg}, &res); err != nil {
+		return err
+	}
+	if !res.OK {
+		return &apiError{msg: "slack: " + res.Error, temporary: res.Error == "ratelimited"}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	telegramAPI = "https://api.telegram.org"
+	// telegramLimit is the most characters a Telegram message can hold.
+	telegramLimit = 4096
+)
+
+// Telegram sends through the Telegram Bot API's sendMessage. Attachments are
+// appended to the text.
+type Telegram struct {
+	Token  string
+	ChatID string
+	// BaseURL defaults to https://api.telegram.org.
+	BaseURL string
+	Client  *http.Client
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+}
+
+func (t *Telegram) Notify(ctx context.Context, msg Message) error {
+	base := t.BaseURL
+	if base == "" {
+		base = telegramAPI
+	}
+	body := map[string]string{
+		"chat_id": t.ChatID,
+		"text":    truncate(msg.PlainText(), telegramLimit),
+	}
+	res := telegramResponse{}
+	if err := postJSON(ctx, t.Client, base+"/bot"+t.Token+"/sendMessage", nil, body, &res); err != nil {
+		return err
+	}
+	if !res.OK {
+		return &apiError{msg: "telegram: " + res.Description, temporary: res.ErrorCode == http.StatusTooManyRequests}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+)
+
+// Webhook posts the Message itself as JSON to any URL, for services of our
+// own. Blocks are left out:
+//
+//	{"text": "...", "attachments": [{"color": "#e01e5a", "title": "...", "text": "..."}]}
+type Webhook struct {
+	URL    string
+	Header http.Header
+	Client *http.Client
+}
+
+func (w *Webhook) Notify(ctx context.Context, msg Message) error {
+	msg.Blocks = nil
+	return postJSON(ctx, w.Client, w.URL, w.Header, msg, nil)
+}
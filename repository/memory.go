@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/abx123/go-covid/model"
+)
+
+var _ RecordRepository = (*Memory)(nil)
+
+// Memory is a RecordRepository held in process memory, for tests and local
+// runs. Records are copied on the way in and out so callers cannot mutate
+// what is stored. Field projections are ignored and whole records returned.
+type Memory struct {
+	mu        sync.RWMutex
+	records   map[string]model.Record
+	revisions []model.Revision
+}
+
+func NewMemory(recs ...model.Record) *Memory {
+	m := &Memory{records: map[string]model.Record{}}
+	for _, r := range recs {
+		m.records[r.Date] = clone(r)
+	}
+	return m
+}
+
+func clone(rec model.Record) model.Record {
+	if rec.States != nil {
+		states := make(map[string]model.State, len(rec.States))
+		for k, v := range rec.States {
+			states[k] = v
+		}
+		rec.States = states
+	}
+	return rec
+}
+
+// dates returns the stored dates in ascending order. The caller must hold mu.
+func (m *Memory) dates() []string {
+	res := make([]string, 0, len(m.records))
+	for k := range m.records {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (m *Memory) Latest(ctx context.Context, fields ...string) (*model.Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	dates := m.dates()
+	if len(dates) == 0 {
+		return nil, ErrNotFound
+	}
+	rec := clone(m.records[dates[len(dates)-1]])
+	return &rec, nil
+}
+
+func (m *Memory) ByDate(ctx context.Context, date string, fields ...string) (*model.Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rec, ok := m.records[date]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	rec = clone(rec)
+	return &rec, nil
+}
+
+func (m *Memory) Range(ctx context.Context, from, to string, fields ...string) ([]*model.Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := []*model.Record{}
+	for _, d := range m.dates() {
+		if (from != "" && d < from) || (to != "" && d > to) {
+			continue
+		}
+		rec := clone(m.records[d])
+		res = append(res, &rec)
+	}
+	return res, nil
+}
+
+func (m *Memory) Upsert(ctx context.Context, rec model.Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[rec.Date] = clone(rec)
+	return nil
+}
+
+func (m *Memory) States(ctx context.Context, date string) (map[string]model.State, error) {
+	var rec *model.Record
+	var err error
+	if date == "" {
+		rec, err = m.Latest(ctx)
+	} else {
+		rec, err = m.ByDate(ctx, date)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rec.States, nil
+}
+
+func (m *Memory) SaveRevisions(ctx context.Context, revs []model.Revision) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revisions = append(m.revisions, revs...)
+	return nil
+}
+
+// Revisions returns everything passed to SaveRevisions so far.
+func (m *Memory) Revisions() []model.Revision {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]model.Revision(nil), m.revisions...)
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/abx123/go-covid/model"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(
+		model.Record{Date: "2021-09-02", NewCases: 2, States: map[string]model.State{"Selangor": {Name: "Selangor", NewCases: 20}}},
+		model.Record{Date: "2021-09-01", NewCases: 1, States: map[string]model.State{"Selangor": {Name: "Selangor", NewCases: 10}}},
+		model.Record{Date: "2021-09-03", NewCases: 3},
+	)
+
+	rec, err := m.Latest(ctx)
+	if err != nil || rec.Date != "2021-09-03" {
+		t.Errorf("Latest = %+v, %v, want 2021-09-03", rec, err)
+	}
+	if _, err := m.ByDate(ctx, "2020-01-01"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ByDate missing day: %v, want ErrNotFound", err)
+	}
+
+	recs, err := m.Range(ctx, "2021-09-02", "")
+	if err != nil || len(recs) != 2 || recs[0].Date != "2021-09-02" || recs[1].Date != "2021-09-03" {
+		t.Errorf("Range from 2021-09-02 = %v, %v", recs, err)
+	}
+
+	states, err := m.States(ctx, "2021-09-01")
+	if err != nil || states["Selangor"].NewCases != 10 {
+		t.Errorf("States(2021-09-01) = %v, %v", states, err)
+	}
+	// Callers get copies and cannot change what is stored.
+	states["Selangor"] = model.State{Name: "Selangor", NewCases: -1}
+	if again, _ := m.States(ctx, "2021-09-01"); again["Selangor"].NewCases != 10 {
+		t.Errorf("stored state changed to %+v through a returned map", again["Selangor"])
+	}
+	if states, err := m.States(ctx, ""); err != nil || len(states) != 0 {
+		t.Errorf("States of latest day = %v, %v, want none", states, err)
+	}
+
+	if err := m.Upsert(ctx, model.Record{Date: "2021-09-03", NewCases: 30}); err != nil {
+		t.Fatal(err)
+	}
+	if rec, _ := m.ByDate(ctx, "2021-09-03"); rec.NewCases != 30 {
+		t.Errorf("after Upsert NewCases = %d, want 30", rec.NewCases)
+	}
+
+	revs := []model.Revision{{Date: "2021-09-03", Field: "newCases"}}
+	if err := m.SaveRevisions(ctx, revs); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Revisions(); len(got) != 1 || got[0].Field != "newCases" {
+		t.Errorf("Revisions = %+v", got)
+	}
+}
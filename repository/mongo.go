@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/abx123/go-covid/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+var _ RecordRepository = (*Mongo)(nil)
+
+// wrap marks errors caused by the server being unreachable with
+// ErrUnavailable.
+func wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	if mongo.IsTimeout(err) || mongo.IsNetworkError(err) || errors.As(err, &topology.ServerSelectionError{}) {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return err
+}
+
+// Mongo keeps records in the "my" collection and revisions in "revisions".
+type Mongo struct {
+	records   *mongo.Collection
+	revisions *mongo.Collection
+}
+
+func NewMongo(db *mongo.Database) *Mongo {
+	return &Mongo{
+		records:   db.Collection("my"),
+		revisions: db.Collection("revisions"),
+	}
+}
+
+// EnsureIndexes makes date unique so overlapping runs cannot store the same
+// day twice. It first removes the duplicates earlier runs left, since the
+// index cannot be built over them, and re-keys documents stored before IDs
+// were derived from the date. Creating an index that already exists is a
+// no-op.
+func (m *Mongo) EnsureIndexes(ctx context.Context) error {
+	if err := m.removeDuplicates(ctx); err != nil {
+		return err
+	}
+	if err := m.migrateIDs(ctx); err != nil {
+		return err
+	}
+	_, err := m.records.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "date", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return wrap(err)
+}
+
+// removeDuplicates keeps one document per date: the one with the
+// date-derived _id when there is one, otherwise the most recently inserted.
+func (m *Mongo) removeDuplicates(ctx context.Context) error {
+	cursor, err := m.records.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sort", Value: bson.M{"_id": -1}}},
+		{{Key: "$group", Value: bson.M{"_id": "$date", "ids": bson.M{"$push": "$_id"}, "n": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"n": bson.M{"$gt": 1}}}},
+	})
+	if err != nil {
+		return wrap(err)
+	}
+	defer cursor.Close(ctx)
+	stale := []interface{}{}
+	for cursor.Next(ctx) {
+		dup := struct {
+			Date string        `bson:"_id"`
+			IDs  []interface{} `bson:"ids"`
+		}{}
+		if err := cursor.Decode(&dup); err != nil {
+			return err
+		}
+		keep := dup.IDs[0]
+		if id, err := model.IDFromDate(dup.Date); err == nil {
+			for _, v := range dup.IDs {
+				if v == id {
+					keep = v
+				}
+			}
+		}
+		for _, v := range dup.IDs {
+			if v != keep {
+				stale = append(stale, v)
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return wrap(err)
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	_, err = m.records.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": stale}})
+	return wrap(err)
+}
+
+// migrateIDs moves documents with a random _id to the date-derived one.
+// _id is immutable, so each is deleted and inserted again under the new ID,
+// and put back as it was if that insert fails.
+func (m *Mongo) migrateIDs(ctx context.Context) error {
+	opt := options.Find().SetProjection(bson.M{"_id": 1, "date": 1})
+	cursor, err := m.records.Find(ctx, bson.M{}, opt)
+	if err != nil {
+		return wrap(err)
+	}
+	defer cursor.Close(ctx)
+	stale := []model.Record{}
+	for cursor.Next(ctx) {
+		rec := model.Record{}
+		if err := cursor.Decode(&rec); err != nil {
+			return err
+		}
+		if id, err := model.IDFromDate(rec.Date); err == nil && id != rec.ID {
+			stale = append(stale, rec)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return wrap(err)
+	}
+	for _, rec := range stale {
+		doc := bson.D{}
+		if err := m.records.FindOne(ctx, bson.M{"_id": rec.ID}).Decode(&doc); err != nil {
+			return wrap(err)
+		}
+		id, _ := model.IDFromDate(rec.Date)
+		moved := bson.D{{Key: "_id", Value: id}}
+		for _, e := range doc {
+			if e.Key != "_id" {
+				moved = append(moved, e)
+			}
+		}
+		if _, err := m.records.DeleteOne(ctx, bson.M{"_id": rec.ID}); err != nil {
+			return wrap(err)
+		}
+		if _, err := m.records.InsertOne(ctx, moved); err != nil {
+			if _, rerr := m.records.InsertOne(ctx, doc); rerr != nil {
+				return fmt.Errorf("migrate %s: %v, and restoring it: %w", rec.Date, err, wrap(rerr))
+			}
+			return fmt.Errorf("migrate %s: %w", rec.Date, wrap(err))
+		}
+	}
+	return nil
+}
+
+// projection builds a Mongo projection for fields, or nil to load whole
+// documents.
+func projection(fields []string) bson.M {
+	if len(fields) == 0 {
+		return nil
+	}
+	res := bson.M{"date": 1}
+	for _, f := range fields {
+		res[f] = 1
+	}
+	return res
+}
+
+func (m *Mongo) Latest(ctx context.Context, fields ...string) (*model.Record, error) {
+	return m.findOne(ctx, bson.M{}, fields)
+}
+
+func (m *Mongo) ByDate(ctx context.Context, date string, fields ...string) (*model.Record, error) {
+	return m.findOne(ctx, bson.M{"date": date}, fields)
+}
+
+func (m *Mongo) findOne(ctx context.Context, filter bson.M, fields []string) (*model.Record, error) {
+	res := &model.Record{}
+	opt := options.FindOne()
+	opt.SetSort(bson.M{"date": -1})
+	if p := projection(fields); p != nil {
+		opt.SetProjection(p)
+	}
+	err := m.records.FindOne(ctx, filter, opt).Decode(res)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return res, nil
+}
+
+func (m *Mongo) Range(ctx context.Context, from, to string, fields ...string) ([]*model.Record, error) {
+	date := bson.M{}
+	if from != "" {
+		date["$gte"] = from
+	}
+	if to != "" {
+		date["$lte"] = to
+	}
+	filter := bson.M{}
+	if len(date) > 0 {
+		filter["date"] = date
+	}
+	opt := options.Find()
+	opt.SetSort(bson.M{"date": 1})
+	if p := projection(fields); p != nil {
+		opt.SetProjection(p)
+	}
+	cursor, err := m.records.Find(ctx, filter, opt)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	defer cursor.Close(ctx)
+	res := []*model.Record{}
+	for cursor.Next(ctx) {
+		rec := &model.Record{}
+		if err := cursor.Decode(rec); err != nil {
+			return nil, err
+		}
+		res = append(res, rec)
+	}
+	return res, wrap(cursor.Err())
+}
+
+// Upsert replaces the whole document rather than $set-ing it, so revised
+// values that dropped to zero are not left behind by omitempty. Records
+// without an ID are keyed by their date.
+func (m *Mongo) Upsert(ctx context.Context, rec model.Record) error {
+	if rec.ID.IsZero() {
+		id, err := model.IDFromDate(rec.Date)
+		if err != nil {
+			return err
+		}
+		rec.ID = id
+	}
+	opt := options.Replace().SetUpsert(true)
+	_, err := m.records.ReplaceOne(ctx, bson.M{"_id": rec.ID}, rec, opt)
+	return wrap(err)
+}
+
+func (m *Mongo) States(ctx context.Context, date string) (map[string]model.State, error) {
+	filter := bson.M{}
+	if date != "" {
+		filter["date"] = date
+	}
+	res := &model.Record{}
+	opt := options.FindOne()
+	opt.SetSort(bson.M{"date": -1})
+	opt.SetProjection(bson.M{"states": 1})
+	err := m.records.FindOne(ctx, filter, opt).Decode(res)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return res.States, nil
+}
+
+func (m *Mongo) SaveRevisions(ctx context.Context, revs []model.Revision) error {
+	if len(revs) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(revs))
+	for i, r := range revs {
+		docs[i] = r
+	}
+	_, err := m.revisions.InsertMany(ctx, docs)
+	return wrap(err)
+}
@@ -0,0 +1,41 @@
+// Package repository stores daily Records independently of the database
+// behind them.
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/abx123/go-covid/model"
+)
+
+var (
+	// ErrNotFound is returned when no record matches a lookup.
+	ErrNotFound = errors.New("record not found")
+	// ErrUnavailable wraps errors caused by the store being unreachable, as
+	// opposed to a bad query.
+	ErrUnavailable = errors.New("storage unavailable")
+)
+
+// RecordRepository is the storage every binary reads and writes Records
+// through. Dates are YYYY-MM-DD strings.
+//
+// The read methods take optional BSON paths, such as "death.newDeaths", to
+// load only part of each record. They are a hint: an implementation may
+// return more than was asked for, but date is always filled in.
+type RecordRepository interface {
+	// Latest returns the most recent record.
+	Latest(ctx context.Context, fields ...string) (*model.Record, error)
+	// ByDate returns the record for one day.
+	ByDate(ctx context.Context, date string, fields ...string) (*model.Record, error)
+	// Range returns the records between from and to inclusive, oldest
+	// first. An empty bound leaves that side open.
+	Range(ctx context.Context, from, to string, fields ...string) ([]*model.Record, error)
+	// Upsert stores rec, replacing any record for the same date.
+	Upsert(ctx context.Context, rec model.Record) error
+	// States returns the per-state breakdown for one day, or for the latest
+	// day when date is empty.
+	States(ctx context.Context, date string) (map[string]model.State, error)
+	// SaveRevisions appends to the log of values MoH revised.
+	SaveRevisions(ctx context.Context, revs []model.Revision) error
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abx123/go-covid/metrics"
+	"github.com/abx123/go-covid/model"
+	"github.com/abx123/go-covid/repository"
+)
+
+// flags are the Slack emoji for Malaysia and each state.
+var flags = map[string]string{
+	"Selangor":          ":selangor:",
+	"W.P. Putrajaya":    ":putrajaya:",
+	"Kedah":             ":kedah:",
+	"Pulau Pinang":      ":ppinang:",
+	"Sarawak":           ":sarawak:",
+	"Kelantan":          ":kelantan:",
+	"Malaysia":          ":malaysia:",
+	"Johor":             ":johor:",
+	"W.P. Labuan":       ":labuan:",
+	"Melaka":            ":melaka:",
+	"Terengganu":        ":terengganu:",
+	"W.P. Kuala Lumpur": ":kl:",
+	"Sabah":             ":sabah:",
+	"Negeri Sembilan":   ":n9:",
+	"Perak":             ":perak:",
+	"Perlis":            ":perlis:",
+	"Pahang":            ":pahang:",
+}
+
+const (
+	greeting   = ":bb-come-ady-2::bb-here::bb-who-find:"
+	puzzled    = ":bb-say-what::bb-no-understand:"
+	sparkBlock = "▁▂▃▄▅▆▇█"
+)
+
+// answer runs c against repo and returns the reply text.
+func answer(ctx context.Context, repo repository.RecordRepository, c command) (string, error) {
+	switch c.Kind {
+	case cmdGreet:
+		return greeting, nil
+	case cmdHelp:
+		return helpText(), nil
+	case cmdTrend:
+		return trend(ctx, repo, c)
+	}
+	if c.From != "" {
+		return summary(ctx, repo, c)
+	}
+	rec, err := getRecord(ctx, repo, c.Date)
+	if errors.Is(err, repository.ErrNotFound) {
+		return noData(c.Date), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	switch c.Kind {
+	case cmdCompare:
+		return compareText(rec, c.States), nil
+	case cmdICU:
+		return icuText(rec, c.state()), nil
+	}
+	return recordText(rec, c.state()), nil
+}
+
+func noData(date string) string {
+	if date == "" {
+		return "No data yet."
+	}
+	return fmt.Sprintf("No data for %s yet.", date)
+}
+
+// compareText puts the figures of names on rec side by side.
+func compareText(rec *model.Record, names []string) string {
+	rows := []struct {
+		label string
+		value func(model.State) string
+	}{
+		{"New Cases", func(s model.State) string { return strconv.Itoa(s.NewCases) }},
+		{"Import Cases", func(s model.State) string { return strconv.Itoa(s.ImportCases) }},
+		{"Recovered", func(s model.State) string { return strconv.Itoa(s.RecoveredCases) }},
+		{"Active Cases", func(s model.State) string { return strconv.Itoa(s.ActiveCases) }},
+		{"New Deaths", func(s model.State) string { return strconv.Itoa(s.Death.NewDeaths) }},
+		{"7-day Avg", func(s model.State) string {
+			return derived(s.Derived, func(d *model.Derived) *float64 { return d.NewCasesAvg7 }, "")
+		}},
+		{"Week-over-Week", func(s model.State) string {
+			return derived(s.Derived, func(d *model.Derived) *float64 { return d.CasesWeekOverWeek }, "%")
+		}},
+		{"Per 100k", func(s model.State) string {
+			return derived(s.Derived, func(d *model.Derived) *float64 { return d.CasesPer100k }, "")
+		}},
+		{"ICU", func(s model.State) string {
+			return derived(s.Derived, func(d *model.Derived) *float64 {
+				if d.Capacity == nil {
+					return nil
+				}
+				return d.Capacity.ICU
+			}, "%")
+		}},
+	}
+	width := make([]int, len(names))
+	for i, n := range names {
+		width[i] = len(n)
+		if width[i] < 8 {
+			width[i] = 8
+		}
+	}
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("%-15s", ""))
+	for i, n := range names {
+		sb.WriteString(fmt.Sprintf(" %*s", width[i], n))
+	}
+	sb.WriteString("\n")
+	for _, r := range rows {
+		sb.WriteString(fmt.Sprintf("%-15s", r.label))
+		for i, n := range names {
+			v := "n/a"
+			if s, ok := rec.States[n]; ok {
+				v = r.value(s)
+			}
+			sb.WriteString(fmt.Sprintf(" %*s", width[i], v))
+		}
+		sb.WriteString("\n")
+	}
+	title := []string{}
+	for _, n := range names {
+		title = append(title, flags[n])
+	}
+	return fmt.Sprintf("%s as of %s\n```%s```", strings.Join(title, " vs "), rec.Date, sb.String())
+}
+
+// derived formats one derived value, or n/a when it is missing.
+func derived(d *model.Derived, get func(*model.Derived) *float64, suffix string) string {
+	if d == nil || get(d) == nil {
+		return "n/a"
+	}
+	return strconv.FormatFloat(*get(d), 'f', -1, 64) + suffix
+}
+
+// icuText describes the healthcare capacity on rec for state, or nationally
+// when state is empty.
+func icuText(rec *model.Record, state string) string {
+	name := state
+	var c *model.Capacity
+	if state == "" {
+		name = "Malaysia"
+		c = metrics.NationalCapacity(rec)
+	} else if s, ok := rec.States[state]; ok {
+		c = metrics.Capacity(s)
+	}
+	title := fmt.Sprintf("%s %s healthcare capacity as of %s\n", flags[name], name, rec.Date)
+	if c == nil {
+		return title + " No facility data"
+	}
+	status := map[metrics.Level]string{
+		metrics.LevelOK:       "OK",
+		metrics.LevelWarn:     "Warning",
+		metrics.LevelCritical: "Critical",
+	}[metrics.WorstLevel(c)]
+	return title + fmt.Sprintf(" ICU: %s \n ICU (COVID): %s \n Ventilators: %s \n Beds: %s \n COVID Beds: %s \n PKRC: %s \n Status: %s",
+		utilization(c.ICU), utilization(c.ICUCovid), utilization(c.Ventilators),
+		utilization(c.Beds), utilization(c.CovidBeds), utilization(c.PKRC), status)
+}
+
+func utilization(f *float64) string {
+	if f == nil {
+		return "n/a"
+	}
+	return strconv.FormatFloat(*f, 'f', 1, 64) + "%"
+}
+
+// summary totals the figures from c.From to c.To.
+func summary(ctx context.Context, repo repository.RecordRepository, c command) (string, error) {
+	recs, err := repo.Range(ctx, c.From, c.To)
+	if err != nil {
+		return "", err
+	}
+	if len(recs) == 0 {
+		return noData(c.From + " to " + c.To), nil
+	}
+	return summaryText(recs, c.state()), nil
+}
+
+// summaryText sums the daily figures in recs, nationally or for state. The
+// range may end before the last day asked for when MoH has not published
+// it yet, so the dates shown are those of the data.
+func summaryText(recs []*model.Record, state string) string {
+	name := state
+	if name == "" {
+		name = "Malaysia"
+	}
+	total := model.State{}
+	peak, peakDate := -1, ""
+	for _, r := range recs {
+		s := model.State{NewCases: r.NewCases, ImportCases: r.ImportCases, RecoveredCases: r.RecoveredCases, Death: r.Death}
+		if state != "" {
+			s = r.States[state]
+		}
+		total.NewCases += s.NewCases
+		total.ImportCases += s.ImportCases
+		total.RecoveredCases += s.RecoveredCases
+		total.Death.NewDeaths += s.Death.NewDeaths
+		total.Death.BIDDeaths += s.Death.BIDDeaths
+		if s.NewCases > peak {
+			peak, peakDate = s.NewCases, r.Date
+		}
+	}
+	days := len(recs)
+	return fmt.Sprintf("%s %s, %s to %s (%d days)\n New Cases: %d \n Daily Avg Cases: %d \n Peak: %d on %s \n Import Cases: %d \n Recovered Cases: %d \n New Deaths: %d \n Brought in Dead (BID): %d \n",
+		flags[name], name, recs[0].Date, recs[days-1].Date, days,
+		total.NewCases, (total.NewCases+days/2)/days, peak, peakDate,
+		total.ImportCases, total.RecoveredCases, total.Death.NewDeaths, total.Death.BIDDeaths)
+}
+
+// trend loads the c.Days days up to c.Date, or up to the latest day, and
+// describes the new cases over them.
+func trend(ctx context.Context, repo repository.RecordRepository, c command) (string, error) {
+	to := c.Date
+	if to == "" {
+		rec, err := repo.Latest(ctx, "date")
+		if errors.Is(err, repository.ErrNotFound) {
+			return noData(""), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		to = rec.Date
+	}
+	t, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return "", err
+	}
+	field := "newCases"
+	if c.state() != "" {
+		field = "states"
+	}
+	recs, err := repo.Range(ctx, t.AddDate(0, 0, 1-c.Days).Format("2006-01-02"), to, field)
+	if err != nil {
+		return "", err
+	}
+	if len(recs) == 0 {
+		return noData(to), nil
+	}
+	return trendText(recs, c.state()), nil
+}
+
+// trendText describes the new cases in recs, nationally or for state, as a
+// sparkline and a summary.
+func trendText(recs []*model.Record, state string) string {
+	name := state
+	if name == "" {
+		name = "Malaysia"
+	}
+	values := make([]int, len(recs))
+	for i, r := range recs {
+		if state == "" {
+			values[i] = r.NewCases
+		} else {
+			values[i] = r.States[state].NewCases
+		}
+	}
+	lo, hi, peak, sum := values[0], values[0], 0, 0
+	for i, v := range values {
+		sum += v
+		if v < lo {
+			lo = v
+		}
+		if v > hi {
+			hi, peak = v, i
+		}
+	}
+	bars := []rune(sparkBlock)
+	line := strings.Builder{}
+	for _, v := range values {
+		b := 0
+		if hi > lo {
+			b = (v - lo) * (len(bars) - 1) / (hi - lo)
+		}
+		line.WriteRune(bars[b])
+	}
+	first, last := values[0], values[len(values)-1]
+	change := "n/a"
+	if first > 0 {
+		change = fmt.Sprintf("%+.1f%%", 100*float64(last-first)/float64(first))
+	}
+	return fmt.Sprintf("%s %s new cases, %s to %s\n %s \n Latest: %d \n Average: %d \n Peak: %d on %s \n Low: %d \n Change: %s \n",
+		flags[name], name, recs[0].Date, recs[len(recs)-1].Date, line.String(),
+		last, (sum+len(values)/2)/len(values), hi, recs[peak].Date, lo, change)
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/abx123/go-covid/states"
+)
+
+// kind is what a command asks the bot for.
+type kind int
+
+const (
+	cmdGreet   kind = iota // the bot was mentioned with nothing else
+	cmdHelp                // usage
+	cmdShow                // the figures for one day, national or for a state
+	cmdCompare             // two or more states side by side on one day
+	cmdTrend               // new cases over a window of days
+	cmdICU                 // healthcare capacity on one day
+)
+
+// Trend windows, in days.
+const (
+	defaultDays = 14
+	maxDays     = 90
+)
+
+// maxCompare is how many states fit side by side in a reply.
+const maxCompare = 4
+
+// command is a parsed bot message. States holds MoH spellings and is empty
+// for the national figures. Date is empty for the latest day, and From and
+// To are set instead for a range of days.
+type command struct {
+	Kind     kind
+	States   []string
+	Date     string
+	From, To string
+	Days     int
+}
+
+// usage lists the commands in the order help shows them.
+var usage = []struct{ syntax, about string }{
+	{"today [state]", "latest figures, national or for a state"},
+	{"[state] <date>", "figures for one day"},
+	{"[state] <range>", "totals over a range such as last week or this month"},
+	{"compare <state> <state> [date]", "states side by side, also \"<state> vs <state>\""},
+	{"trend [state] [14d]", fmt.Sprintf("new cases over the last days, up to %dd", maxDays)},
+	{"icu [state] [date]", "hospital, ICU and ventilator utilization"},
+	{"help", "this message"},
+}
+
+// keywords are the words that pick a command.
+var keywords = map[string]kind{
+	"help":    cmdHelp,
+	"compare": cmdCompare,
+	"vs":      cmdCompare,
+	"versus":  cmdCompare,
+	"trend":   cmdTrend,
+	"icu":     cmdICU,
+}
+
+// precedence decides between keywords in one message, highest first, so
+// "help compare" is help and "icu trend kl" is a trend.
+var precedence = []kind{cmdHelp, cmdCompare, cmdTrend, cmdICU, cmdShow}
+
+func outranks(a, b kind) bool {
+	for _, k := range precedence {
+		switch k {
+		case a:
+			return true
+		case b:
+			return false
+		}
+	}
+	return false
+}
+
+// national are the words for Malaysia as a whole, which is also what a
+// command without a state covers.
+var national = map[string]bool{
+	"malaysia": true,
+	"cobis":    true,
+	"national": true,
+}
+
+// filler are words that carry no meaning for any command.
+var filler = map[string]bool{
+	"and": true, "with": true, "for": true, "on": true, "in": true,
+	"of": true, "the": true, "show": true, "me": true, "please": true,
+	"cases": true, "data": true,
+}
+
+var (
+	mention = regexp.MustCompile(`<[@#!][^>]*>`)
+	window  = regexp.MustCompile(`^(\d+)d$`)
+)
+
+// parseError is returned for messages that do not form a command. Words
+// holds the tokens that were not understood, when nothing was or when they
+// look like typos.
+type parseError struct {
+	msg   string
+	Words []string
+}
+
+func (e *parseError) Error() string {
+	return e.msg
+}
+
+// tokenize drops Slack mentions and splits text into lowercase words. Dots,
+// dashes and slashes stay inside words so dates and "w.p." survive.
+func tokenize(text string) []string {
+	text = strings.ToLower(mention.ReplaceAllString(text, " "))
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '.' && r != '/'
+	})
+	res := []string{}
+	for _, w := range words {
+		if w = strings.Trim(w, ".-"); w != "" {
+			res = append(res, w)
+		}
+	}
+	return res
+}
+
+// matchState matches the longest state alias starting at tokens[0], returning
+// the MoH spelling and how many tokens it used.
+func matchState(tokens []string) (string, int) {
+	for n := 3; n > 0; n-- {
+		if n > len(tokens) {
+			continue
+		}
+		if s, ok := states.Normalize(strings.Join(tokens[:n], " ")); ok {
+			return s, n
+		}
+	}
+	return "", 0
+}
+
+// parse turns a message into a command, resolving relative dates against
+// now. A keyword picks the command; without one, two states mean compare, a
+// window such as "7d" means trend and anything else shows one day or a
+// range. Words the grammar does not know are ignored as chatter, so "what
+// is covid in kl" works, unless they are all there is or look like a typo
+// of a state or command, since "trend selangr" must not answer for
+// Malaysia.
+func parse(text string, now time.Time) (command, error) {
+	tokens := tokenize(text)
+	c := command{}
+	verb, hasVerb := cmdShow, false
+	dates, unknown := []span{}, []string{}
+	known := false
+	for i := 0; i < len(tokens); {
+		t := tokens[i]
+		if s, n := matchState(tokens[i:]); n > 0 {
+			c.States = appendUnique(c.States, s)
+			i += n
+			continue
+		}
+		if s, n := matchDate(tokens[i:], now); n > 0 {
+			if len(dates) == 0 || dates[0] != s {
+				dates = append(dates, s)
+			}
+			i += n
+			continue
+		}
+		i++
+		if k, ok := keywords[t]; ok {
+			if !hasVerb || outranks(k, verb) {
+				verb, hasVerb = k, true
+			}
+			continue
+		}
+		if national[t] {
+			known = true
+			continue
+		}
+		if filler[t] {
+			continue
+		}
+		if m := window.FindStringSubmatch(t); m != nil {
+			c.Days, _ = strconv.Atoi(m[1])
+			continue
+		}
+		if d, err := strconv.Atoi(t); err == nil && i < len(tokens) && (tokens[i] == "days" || tokens[i] == "day" || tokens[i] == "hari") {
+			c.Days = d
+			i++
+			continue
+		}
+		unknown = append(unknown, t)
+	}
+	typos := []string{}
+	for _, w := range unknown {
+		if _, ok := closest(w); ok {
+			typos = append(typos, w)
+		}
+	}
+	if len(typos) == 0 && len(unknown) > 1 {
+		if _, ok := closest(strings.Join(unknown, " ")); ok {
+			typos = unknown
+		}
+	}
+
+	known = known || hasVerb || len(c.States) > 0 || len(dates) > 0 || c.Days > 0
+	if !known {
+		typos = unknown
+	}
+	if len(typos) > 0 {
+		return c, &parseError{msg: fmt.Sprintf("I don't know %q", strings.Join(typos, " ")), Words: typos}
+	}
+	if len(dates) > 1 {
+		return c, &parseError{msg: "give one date at a time"}
+	}
+	if !hasVerb {
+		switch {
+		case len(tokens) == 0:
+			verb = cmdGreet
+		case len(c.States) > 1:
+			verb = cmdCompare
+		case c.Days > 0:
+			verb = cmdTrend
+		}
+	}
+	c.Kind = verb
+
+	switch c.Kind {
+	case cmdCompare:
+		if len(c.States) < 2 || len(c.States) > maxCompare {
+			return c, &parseError{msg: fmt.Sprintf("compare takes 2 to %d states", maxCompare)}
+		}
+	case cmdShow, cmdTrend, cmdICU:
+		if len(c.States) > 1 {
+			return c, &parseError{msg: "one state at a time, or compare them"}
+		}
+	}
+	if len(dates) == 1 && !dates[0].Latest {
+		d := dates[0]
+		switch {
+		case d.single():
+			c.Date = d.From
+		case c.Kind == cmdShow:
+			c.From, c.To = d.From, d.To
+		case c.Kind == cmdTrend:
+			if c.Days > 0 {
+				return c, &parseError{msg: "a range or a number of days, not both"}
+			}
+			c.Date, c.Days = d.To, d.days()
+		default:
+			return c, &parseError{msg: "a range only goes with a plain lookup or trend"}
+		}
+	}
+	if c.Kind == cmdTrend {
+		if c.Days == 0 {
+			c.Days = defaultDays
+		}
+		if c.Days < 2 || c.Days > maxDays {
+			return c, &parseError{msg: fmt.Sprintf("trend covers 2 to %d days", maxDays)}
+		}
+	}
+	if c.Days > 0 && c.Kind != cmdTrend {
+		return c, &parseError{msg: "a number of days only goes with trend"}
+	}
+	return c, nil
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// state returns the single state c is about, or "" for the national
+// figures.
+func (c command) state() string {
+	if len(c.States) == 0 {
+		return ""
+	}
+	return c.States[0]
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	// Thursday 2021-09-16 in Malaysia, still Wednesday in UTC.
+	now := time.Date(2021, 9, 15, 23, 30, 0, 0, time.UTC)
+	kl, sel := "W.P. Kuala Lumpur", "Selangor"
+	tests := []struct {
+		text string
+		want command
+		err  bool
+	}{
+		{text: "<@U0188FCRJ9H>", want: command{Kind: cmdGreet}},
+		{text: "help", want: command{Kind: cmdHelp}},
+		{text: "help compare", want: command{Kind: cmdHelp}},
+		{text: "cobis", want: command{Kind: cmdShow}},
+		{text: "today kl", want: command{Kind: cmdShow, States: []string{kl}}},
+		{text: "hari ini", want: command{Kind: cmdShow}},
+		{text: "selangor 2021-09-01", want: command{Kind: cmdShow, States: []string{sel}, Date: "2021-09-01"}},
+		{text: "W.P. Kuala Lumpur yesterday", want: command{Kind: cmdShow, States: []string{kl}, Date: "2021-09-15"}},
+		{text: "what is covid in kl", want: command{Kind: cmdShow, States: []string{kl}}},
+		{text: "how is selangor today", want: command{Kind: cmdShow, States: []string{sel}}},
+		{text: "kl vs selangor", want: command{Kind: cmdCompare, States: []string{kl, sel}}},
+		{text: "selangor vs kl", want: command{Kind: cmdCompare, States: []string{sel, kl}}},
+		{text: "compare negeri sembilan and penang 1/9/2021", want: command{Kind: cmdCompare, States: []string{"Negeri Sembilan", "Pulau Pinang"}, Date: "2021-09-01"}},
+		{text: "trend selangor", want: command{Kind: cmdTrend, States: []string{sel}, Days: defaultDays}},
+		{text: "trend kl 7d", want: command{Kind: cmdTrend, States: []string{kl}, Days: 7}},
+		{text: "kl 30 days", want: command{Kind: cmdTrend, States: []string{kl}, Days: 30}},
+		{text: "trend last month", want: command{Kind: cmdTrend, Date: "2021-08-31", Days: 31}},
+		{text: "icu penang", want: command{Kind: cmdICU, States: []string{"Pulau Pinang"}}},
+		{text: "last week", want: command{Kind: cmdShow, From: "2021-09-06", To: "2021-09-12"}},
+		{text: "selangor bulan ini", want: command{Kind: cmdShow, States: []string{sel}, From: "2021-09-01", To: "2021-09-16"}},
+
+		{text: "selangr", err: true},
+		{text: "trend selangr", err: true},
+		{text: "icu johr", err: true},
+		{text: "selangr yesterday", err: true},
+		{text: "kl vs selangr", err: true},
+		{text: "compare kl", err: true},
+		{text: "kl selangor penang johor perak", err: true},
+		{text: "kl yesterday 2021-09-01", err: true},
+		{text: "trend 200d", err: true},
+		{text: "trend this week 7d", err: true},
+		{text: "icu last week", err: true},
+		{text: "kl 7d icu", err: true},
+	}
+	for _, tc := range tests {
+		got, err := parse(tc.text, now)
+		if tc.err {
+			pe := &parseError{}
+			if !errors.As(err, &pe) {
+				t.Errorf("parse(%q) = %+v, %v, want a parseError", tc.text, got, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parse(%q): %v", tc.text, err)
+			continue
+		}
+		if len(got.States) == 0 {
+			got.States = nil
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parse(%q) = %+v, want %+v", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	tests := map[string]string{
+		"selangr":      "`selangor`",
+		"trnd":         "`trend`",
+		"kuala lumpor": "`kuala lumpur`",
+		"is":           "",
+		"what is it":   "",
+		// A typo next to something recognised still gets a suggestion.
+		"trend selangr":     "`selangor`",
+		"icu johr":          "`johor`",
+		"selangr yesterday": "`selangor`",
+		"kl vs selangr":     "`selangor`",
+	}
+	for text, want := range tests {
+		_, err := parse(text, time.Now())
+		pe := &parseError{}
+		if !errors.As(err, &pe) {
+			t.Fatalf("parse(%q) did not fail", text)
+		}
+		got := ""
+		if s := suggest(pe.Words); len(s) > 0 {
+			got = s[0]
+		}
+		if got != want {
+			t.Errorf("suggest(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+const layout = "2006-01-02"
+
+// malaysia is the time zone dates are resolved in. Malaysia has no daylight
+// saving, so the fixed offset is exact when the zone database is missing.
+var malaysia = func() *time.Location {
+	if loc, err := time.LoadLocation("Asia/Kuala_Lumpur"); err == nil {
+		return loc
+	}
+	return time.FixedZone("MYT", 8*60*60)
+}()
+
+// span is a resolved date phrase: one day when From equals To, otherwise
+// an inclusive range. Latest marks "today", which means the latest day with
+// data since MoH publishes in the evening.
+type span struct {
+	From, To string
+	Latest   bool
+}
+
+func (s span) single() bool {
+	return s.From == s.To
+}
+
+// days is the number of days s covers.
+func (s span) days() int {
+	from, _ := time.Parse(layout, s.From)
+	to, _ := time.Parse(layout, s.To)
+	return int(to.Sub(from).Hours()/24) + 1
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday, "ahad": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday, "isnin": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "selasa": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday, "rabu": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "khamis": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday, "jumaat": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday, "sabtu": time.Saturday,
+}
+
+var months = map[string]time.Month{
+	"jan": time.January, "january": time.January, "januari": time.January,
+	"feb": time.February, "february": time.February, "februari": time.February,
+	"mar": time.March, "march": time.March, "mac": time.March,
+	"apr": time.April, "april": time.April,
+	"may": time.May, "mei": time.May,
+	"jun": time.June, "june": time.June,
+	"jul": time.July, "july": time.July, "julai": time.July,
+	"aug": time.August, "august": time.August, "ogos": time.August,
+	"sep": time.September, "sept": time.September, "september": time.September,
+	"oct": time.October, "october": time.October, "okt": time.October, "oktober": time.October,
+	"nov": time.November, "november": time.November,
+	"dec": time.December, "december": time.December, "dis": time.December, "disember": time.December,
+}
+
+// Words for "this", "last" and "ago"; Malay puts them after the noun.
+var (
+	this = map[string]bool{"this": true, "ini": true}
+	last = map[string]bool{"last": true, "previous": true, "lepas": true, "lalu": true, "sudah": true}
+	ago  = map[string]bool{"ago": true, "lepas": true, "lalu": true}
+)
+
+// matchDate resolves the date phrase at the start of tokens relative to
+// now, returning it and how many tokens it used, or 0 when there is none.
+func matchDate(tokens []string, now time.Time) (span, int) {
+	now = now.In(malaysia)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	day := func(t time.Time) span {
+		return span{From: t.Format(layout), To: t.Format(layout)}
+	}
+	between := func(from, to time.Time) span {
+		return span{From: from.Format(layout), To: to.Format(layout)}
+	}
+	at := func(i int) string {
+		if i < len(tokens) {
+			return tokens[i]
+		}
+		return ""
+	}
+	t0, t1, t2 := at(0), at(1), at(2)
+
+	switch {
+	case t0 == "today" || t0 == "latest" || t0 == "terkini":
+		return span{Latest: true}, 1
+	case t0 == "hari" && t1 == "ini":
+		return span{Latest: true}, 2
+	case t0 == "yesterday" || t0 == "semalam":
+		return day(today.AddDate(0, 0, -1)), 1
+	}
+
+	// "last monday", "monday", "isnin lepas": the most recent one before
+	// today.
+	if w, ok := weekdays[t1]; ok && last[t0] {
+		return day(before(today, w)), 2
+	}
+	if w, ok := weekdays[t0]; ok {
+		if last[t1] {
+			return day(before(today, w)), 2
+		}
+		return day(before(today, w)), 1
+	}
+
+	// "this week", "minggu lepas", "last month", "bulan ini".
+	unit, rel, n := t1, t0, 2
+	if t0 == "week" || t0 == "minggu" || t0 == "month" || t0 == "bulan" {
+		unit, rel = t0, t1
+	}
+	if this[rel] || last[rel] {
+		switch unit {
+		case "week", "minggu":
+			monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+			if this[rel] {
+				return between(monday, today), n
+			}
+			return between(monday.AddDate(0, 0, -7), monday.AddDate(0, 0, -1)), n
+		case "month", "bulan":
+			first := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+			if this[rel] {
+				return between(first, today), n
+			}
+			return between(first.AddDate(0, -1, 0), first.AddDate(0, 0, -1)), n
+		}
+	}
+
+	// "7 days ago", "7 hari lepas", "7 hari yang lalu".
+	if d, err := strconv.Atoi(t0); err == nil && (t1 == "days" || t1 == "day" || t1 == "hari") {
+		n := 2
+		if t2 == "yang" {
+			n++
+		}
+		if ago[at(n)] {
+			return day(today.AddDate(0, 0, -d)), n + 1
+		}
+	}
+
+	// "2021-09-01", "1/9/2021", "1 sep 2021" and "1 september", which is
+	// this year's.
+	for _, f := range []string{layout, "2/1/2006"} {
+		if t, err := time.Parse(f, t0); err == nil {
+			return day(t), 1
+		}
+	}
+	if d, err := strconv.Atoi(t0); err == nil {
+		if m, ok := months[t1]; ok {
+			y, n := today.Year(), 2
+			if v, err := strconv.Atoi(t2); err == nil && len(t2) == 4 {
+				y, n = v, 3
+			}
+			t := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+			if t.Day() == d {
+				return day(t), n
+			}
+		}
+	}
+	return span{}, 0
+}
+
+// before is the last w strictly before t.
+func before(t time.Time, w time.Weekday) time.Time {
+	d := (int(t.Weekday()) - int(w) + 7) % 7
+	if d == 0 {
+		d = 7
+	}
+	return t.AddDate(0, 0, -d)
+}
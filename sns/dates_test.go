@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatchDate(t *testing.T) {
+	// Thursday 2021-09-16 in Malaysia, still Wednesday in UTC.
+	now := time.Date(2021, 9, 15, 23, 30, 0, 0, time.UTC)
+	day := func(d string) span { return span{From: d, To: d} }
+	tests := []struct {
+		text string
+		want span
+		n    int
+	}{
+		{"today", span{Latest: true}, 1},
+		{"hari ini", span{Latest: true}, 2},
+		{"yesterday", day("2021-09-15"), 1},
+		{"semalam", day("2021-09-15"), 1},
+		{"7 days ago", day("2021-09-09"), 3},
+		{"7 hari lepas", day("2021-09-09"), 3},
+		{"3 hari yang lalu", day("2021-09-13"), 4},
+		{"last monday", day("2021-09-13"), 2},
+		{"isnin lepas", day("2021-09-13"), 2},
+		{"thursday", day("2021-09-09"), 1},
+		{"this week", span{From: "2021-09-13", To: "2021-09-16"}, 2},
+		{"last week", span{From: "2021-09-06", To: "2021-09-12"}, 2},
+		{"minggu lepas", span{From: "2021-09-06", To: "2021-09-12"}, 2},
+		{"this month", span{From: "2021-09-01", To: "2021-09-16"}, 2},
+		{"bulan lepas", span{From: "2021-08-01", To: "2021-08-31"}, 2},
+		{"2021-09-01", day("2021-09-01"), 1},
+		{"1/9/2021", day("2021-09-01"), 1},
+		{"1 sep 2021", day("2021-09-01"), 3},
+		{"31 ogos", day("2021-08-31"), 2},
+		{"30 feb", span{}, 0},
+		{"7 days", span{}, 0},
+		{"selangor", span{}, 0},
+	}
+	for _, tc := range tests {
+		got, n := matchDate(tokenize(tc.text), now)
+		if got != tc.want || n != tc.n {
+			t.Errorf("matchDate(%q) = %+v, %d, want %+v, %d", tc.text, got, n, tc.want, tc.n)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/abx123/go-covid/states"
+)
+
+// dateFormats are examples of the date phrases matchDate understands.
+var dateFormats = []string{
+	"2021-09-01, 1/9/2021, 1 sep 2021, 1 september",
+	"today, latest, hari ini, terkini",
+	"yesterday, semalam",
+	"7 days ago, 7 hari lepas",
+	"last monday, isnin lepas, monday",
+	"this week, minggu ini, last week, minggu lepas",
+	"this month, bulan ini, last month, bulan lepas",
+}
+
+// helpText lists every command, state alias and date format.
+func helpText() string {
+	sb := strings.Builder{}
+	sb.WriteString("Mention me with one of:\n")
+	for _, u := range usage {
+		sb.WriteString(fmt.Sprintf(" `%s` %s\n", u.syntax, u.about))
+	}
+	sb.WriteString("\nStates:\n")
+	for _, name := range states.Names {
+		sb.WriteString(fmt.Sprintf(" %s %s: %s\n", flags[name], name, strings.Join(aliases(name), ", ")))
+	}
+	sb.WriteString(" Leave the state out for Malaysia as a whole.\n")
+	sb.WriteString("\nDates, resolved in Malaysia time:\n")
+	for _, f := range dateFormats {
+		sb.WriteString(" " + f + "\n")
+	}
+	return sb.String()
+}
+
+// aliases are the names state is known by, sorted.
+func aliases(state string) []string {
+	res := []string{}
+	for k, v := range states.Aliases {
+		if v == state {
+			res = append(res, k)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// puzzledText is the reply to a message parse rejected, with a suggestion
+// for words it did not know.
+func puzzledText(err error) string {
+	text := puzzled + " " + err.Error() + "."
+	pe := &parseError{}
+	if errors.As(err, &pe) && len(pe.Words) > 0 {
+		if s := suggest(pe.Words); len(s) > 0 {
+			text += " Did you mean " + strings.Join(s, " ") + "?"
+		}
+	}
+	return text + " Try `help`."
+}
+
+// suggest finds the closest state alias or command for the unknown words,
+// trying them as one phrase first so "kuala lumpor" finds "kuala lumpur".
+func suggest(words []string) []string {
+	if s, ok := closest(strings.Join(words, " ")); ok {
+		return []string{"`" + s + "`"}
+	}
+	res := []string{}
+	for _, w := range words {
+		if s, ok := closest(w); ok {
+			res = append(res, "`"+s+"`")
+		}
+	}
+	return res
+}
+
+// closest returns the candidate nearest to word by edit distance, allowing
+// one edit for every three letters. Words shorter than that get no
+// suggestion, since every two-letter word is near an alias like "ns" or
+// "kl". Ties go to the alphabetically first.
+func closest(word string) (string, bool) {
+	limit := len([]rune(word)) / 3
+	if limit < 1 {
+		return "", false
+	}
+	best, dist := "", limit+1
+	for _, c := range candidates() {
+		if d := distance(word, c); d < dist || (d == dist && c < best) {
+			best, dist = c, d
+		}
+	}
+	return best, dist <= limit
+}
+
+// candidates are the words a typo is matched against: the state aliases
+// and the command names.
+func candidates() []string {
+	res := []string{"today"}
+	for k := range states.Aliases {
+		res = append(res, k)
+	}
+	for k := range keywords {
+		res = append(res, k)
+	}
+	return res
+}
+
+// distance is the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(t)]
+}
+
+func min(v ...int) int {
+	m := v[0]
+	for _, x := range v[1:] {
+		if x < m {
+			m = x
+		}
+	}
+	return m
+}
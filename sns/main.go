@@ -1,19 +1,24 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
+	"log"
 	"os"
-	"regexp"
-	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/abx123/go-covid/dedupe"
+	"github.com/abx123/go-covid/metrics"
+	"github.com/abx123/go-covid/model"
+	"github.com/abx123/go-covid/notify"
+	"github.com/abx123/go-covid/repository"
+	"github.com/abx123/go-covid/slacksig"
+
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -67,215 +72,157 @@ type Elements struct {
 	Elements []Element `json:"elements"`
 }
 
-type Record struct {
-	ID                primitive.ObjectID `bson:"_id,omitempty"`
-	Date              string             `bson:"date,omitempty"`
-	NewCases          int                `bson:"newCases,omitempty"`
-	ImportCases       int                `bson:"importCases,omitempty"`
-	RecoveredCases    int                `bson:"recoveredCases,omitempty"`
-	ClusterImport     int                `bson:"importClusters,omitempty"`
-	ClusterReligious  int                `bson:"religiousClusters,omitempty"`
-	ClusterCommunity  int                `bson:"communityClusters,omitempty"`
-	ClusterHighRisk   int                `bson:"HighRiskClusters,omitempty"`
-	ClusterEducation  int                `bson:"educationClusters,omitempty"`
-	ClusterDentention int                `bson:"detentionClusters,omitempty"`
-	ClusterWorkplace  int                `bson:"workspaceClusters,omitempty"`
-	States            map[string]State   `bson:"states,omitempty"`
-	Death             Death              `bson:"death,omitempty"`
-	Test              Test               `bson:"tests,omitempty"`
-	Population        Population         `bson:"population,omitempty"`
-}
-
-type Population struct {
-	Population int `bson:"population,omitempty"`
-	Over18     int `bson:"over18,omitempty"`
-	Over60     int `bson:"over60,omitempty"`
-	Over12     int `bson:"over12,omitempty"`
+func main() {
+	lambda.Start(handler)
 }
 
-type Test struct {
-	RtkAg int `bson:"rtkAg,omitempty"`
-	Pcr   int `bson:"Pcr,omitempty"`
+func handler(ctx context.Context, snsEvent events.SNSEvent) {
+	n, err := notify.FromEnv("bot", "SLACK")
+	if err != nil || n == nil {
+		log.Println("no notifier configured:", err)
+		return
+	}
+	client, err := NewMongoClient()
+	if err != nil {
+		log.Println("connect:", err)
+		reply(ctx, n, puzzled)
+		return
+	}
+	defer client.Disconnect(context.Background())
+	db := client.Database("covid")
+	ttl := dedupe.DefaultTTL
+	if d, err := time.ParseDuration(os.Getenv("EVENT_TTL")); err == nil && d > 0 {
+		ttl = d
+	}
+	seen := dedupe.NewMongo(db.Collection("slackEvents"), ttl)
+	if err := seen.EnsureIndexes(ctx); err != nil {
+		log.Println("event index:", err)
+	}
+	b := &bot{
+		repo:   repository.NewMongo(db),
+		out:    n,
+		seen:   seen,
+		secret: os.Getenv("SLACK_SIGNING_SECRET"),
+		now:    time.Now,
+	}
+	b.handle(ctx, snsEvent)
 }
 
-type State struct {
-	ImportCases    int        `bson:"importCases,omitempty"`
-	NewCases       int        `bson:"newCases,omitempty"`
-	RecoveredCases int        `bson:"recoveredCases,omitempty"`
-	Death          Death      `bson:"death,omitempty"`
-	Hospital       Hospital   `bson:"hospital,omitempty"`
-	ICU            ICU        `bson:"icu,omitempty"`
-	PKRC           PKRC       `bson:"pkrc,omitempty"`
-	Test           Test       `bson:"test,omitempty"`
-	Population     Population `bson:"population,omitempty"`
+// bot answers the Slack events sns.js forwards through SNS.
+type bot struct {
+	repo repository.RecordRepository
+	out  notify.Notifier
+	// seen holds the event_ids already answered, so Slack's retries of an
+	// event are dropped. A nil store answers every delivery.
+	seen dedupe.Store
+	// secret is the Slack app's signing secret. Without it every event is
+	// rejected.
+	secret string
+	now    func() time.Time
 }
 
-type Hospital struct {
-	Beds                 int `bson:"beds,omitempty"`
-	CovidBeds            int `bson:"covidBeds,omitempty"`
-	NonCriticalBeds      int `bson:"nonCriticalBeds,omitempty"`
-	AdmittedPUI          int `bson:"admittedPui,omitempty"`
-	AdmittedCovid        int `bson:"admittedCovid,omitempty"`
-	AdmittedTotal        int `bson:"admittedTotal,omitempty"`
-	DischargedPui        int `bson:"dischargedPui,omitempty"`
-	DischargedCovid      int `bson:"dischargedCovid,omitempty"`
-	DischargedTotal      int `bson:"dischargedTotal,omitempty"`
-	HospitalizedCovid    int `bson:"hospitalizedCovid,omitempty"`
-	HospitalizedPui      int `bson:"hospitalizedPui,omitempty"`
-	HospitalizedNonCovid int `bson:"hospitalizedNonCovid,omitempty"`
+func (b *bot) handle(ctx context.Context, snsEvent events.SNSEvent) {
+	for _, record := range snsEvent.Records {
+		if err := b.verify(record.SNS); err != nil {
+			log.Println("rejected event:", err)
+			continue
+		}
+		req := Request{}
+		if err := json.Unmarshal([]byte(record.SNS.Message), &req); err != nil {
+			log.Println("invalid event:", err)
+			continue
+		}
+		if req.Type == "url_verification" {
+			// sns.js answers the challenge itself; there is nothing to post.
+			continue
+		}
+		if !b.claim(ctx, req.EventID) {
+			log.Println("duplicate event:", req.EventID)
+			continue
+		}
+		handle(ctx, b.repo, b.out, req, b.now())
+	}
 }
 
-type Death struct {
-	NewDeaths       int `bson:"newDeaths,omitempty"`
-	ActualDeaths    int `bson:"actualDeaths,omitempty"`
-	BIDDeaths       int `bson:"bidDeaths,omitempty"`
-	ActualBIDDeaths int `bson:"actualBidDeaths,omitempty"`
+// claim reports whether eventID has not been answered yet. When the store
+// fails the event is answered anyway, since a double reply beats none.
+func (b *bot) claim(ctx context.Context, eventID string) bool {
+	if b.seen == nil || eventID == "" {
+		return true
+	}
+	ok, err := b.seen.Claim(ctx, eventID)
+	if err != nil {
+		log.Println("claim event:", err)
+		return true
+	}
+	return ok
 }
 
-type ICU struct {
-	ICUBeds             int `bson:"icuBeds,omitempty"`
-	ICUBedsRep          int `bson:"iceBedsRep,omitempty"`
-	ICUBedsTotal        int `bson:"icuBedsTotal,omitempty"`
-	ICUBedsCovid        int `bson:"icuBedsCovid,omitempty"`
-	Ventilators         int `bson:"ventilators,omitempty"`
-	PortableVentilators int `bson:"portableVentilators,omitempty"`
-	ICUCovid            int `bson:"icuCovid,omitempty"`
-	ICUPui              int `bson:"icuPui,omitempty"`
-	ICUNonCovid         int `bson:"icuNonCovid,omitempty"`
-	VentCovid           int `bson:"ventilatorsCovid,omitempty"`
-	VentPui             int `bson:"ventilatorsPui,omitempty"`
-	VentNonCovid        int `bson:"ventilatorsNonCovid,omitempty"`
-	VentUsed            int `bson:"ventilatorsUsed,omitempty"`
-	PortVentUsed        int `bson:"portableVentilatorsUsed,omitempty"`
+// verify checks the Slack signature sns.js copied from the request headers
+// into the message attributes.
+func (b *bot) verify(e events.SNSEntity) error {
+	if b.secret == "" {
+		return errors.New("SLACK_SIGNING_SECRET is not set")
+	}
+	return slacksig.Verify(b.secret, attribute(e, slacksig.SignatureHeader), attribute(e, slacksig.TimestampHeader), []byte(e.Message), b.now())
 }
 
-type PKRC struct {
-	Beds            int `bson:"beds,omitempty"`
-	AdmittedCovid   int `bson:"admittedCovid,omitempty"`
-	AdmittedPui     int `bson:"admittedPui,omitempty"`
-	AdmittedTotal   int `bson:"admittedTotal,omitempty"`
-	DischargedPui   int `bson:"dischargedPui,omitempty"`
-	DischargedCovid int `bson:"dischargedCovid,omitempty"`
-	DischargedTotal int `bson:"dischargedTotal,omitempty"`
-	PKRCCovid       int `bson:"pkrcCovid,omitempty"`
-	PKRCPui         int `bson:"pkrcPui,omitempty"`
-	PKRCNonCovid    int `bson:"pkrcNonCovid,omitempty"`
+// attribute reads a string message attribute, which Lambda delivers as
+// {"Type": "String", "Value": "..."}.
+func attribute(e events.SNSEntity, name string) string {
+	a, ok := e.MessageAttributes[name].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	v, _ := a["Value"].(string)
+	return v
 }
 
-func main() {
-	lambda.Start(handler)
+// reply posts text back to the channel, logging delivery failures.
+func reply(ctx context.Context, n notify.Notifier, text string) {
+	if err := n.Notify(ctx, notify.Message{Text: text}); err != nil {
+		log.Println("reply:", err)
+	}
 }
 
-func handler(ctx context.Context, snsEvent events.SNSEvent) {
-	statesMap := map[string]string{
-		"selangor":        "Selangor",
-		"putrajaya":       "W.P. Putrajaya",
-		"kedah":           "Kedah",
-		"penang":          "Pulau Pinang",
-		"sarawak":         "Sarawak",
-		"kelantan":        "Kelantan",
-		"pulau pinang":    "Pulau Pinang",
-		"johor":           "Johor",
-		"labuan":          "W.P. Labuan",
-		"melaka":          "Melaka",
-		"terengganu":      "Terengganu",
-		"kuala lumpur":    "W.P. Kuala Lumpur",
-		"sabah":           "Sabah",
-		"n9":              "Negeri Sembilan",
-		"perak":           "Perak",
-		"perlis":          "Perlis",
-		"pahang":          "Pahang",
-		"kl":              "W.P. Kuala Lumpur",
-		"negeri sembilan": "Negeri Sembilan",
+// handle answers one Slack event received at now.
+func handle(ctx context.Context, repo repository.RecordRepository, n notify.Notifier, req Request, now time.Time) {
+	if req.Event.Channel != "C0188FC7MAP" && req.Event.Channel != "G01FLHXFZTM" {
+		return
 	}
-	client, _ := NewMongoClient()
-	defer client.Disconnect(context.Background())
-	collection := client.Database("covid").Collection("my")
-	for _, record := range snsEvent.Records {
-		req := Request{}
-		json.Unmarshal([]byte(record.SNS.Message), &req)
-		if req.Event.Channel != "C0188FC7MAP" && req.Event.Channel != "G01FLHXFZTM" {
-			return
-		}
-
-		if req.Event.Text == "<@U0188FCRJ9H>" {
-			rq, _ := json.Marshal(map[string]string{
-				"text": ":bb-come-ady-2::bb-here::bb-who-find:",
-			})
-			_, _ = http.Post(os.Getenv("SLACK"), "application/json", bytes.NewBuffer(rq))
-			return
-		}
-
-		re := regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
-		date := re.FindAllString(req.Event.Text, -1)
-		if len(date) > 0 {
-			rec, _ := getFromMongo(collection, date[0])
-			for k, val := range statesMap {
-				if strings.Contains(strings.ToLower(req.Event.Text), k) {
-					sendToSlack(rec, val)
-					return
-				}
-			}
-			sendToSlack(rec, "")
-			return
-		}
-
-		if strings.Contains(req.Event.Text, "Malaysia") || strings.Contains(req.Event.Text, "cobis") {
-			rec, _ := getFromMongo(collection, "")
-			sendToSlack(rec, "")
-			return
-		}
-		rq, _ := json.Marshal(map[string]string{
-			"text": ":bb-say-what::bb-no-understand:",
-		})
-		_, _ = http.Post(os.Getenv("SLACK"), "application/json", bytes.NewBuffer(rq))
-
+	c, err := parse(req.Event.Text, now)
+	if err != nil {
+		reply(ctx, n, puzzledText(err))
+		return
+	}
+	text, err := answer(ctx, repo, c)
+	if err != nil {
+		log.Println("answer:", err)
+		text = puzzled
 	}
+	reply(ctx, n, text)
 }
 
-func sendToSlack(rec *Record, state string) {
-	flags := map[string]string{
-		"Selangor":          ":selangor:",
-		"W.P. Putrajaya":    ":putrajaya:",
-		"Kedah":             ":kedah:",
-		"Pulau Pinang":      ":ppinang:",
-		"Sarawak":           ":sarawak:",
-		"Kelantan":          ":kelantan:",
-		"Malaysia":          ":malaysia:",
-		"Johor":             ":johor:",
-		"W.P. Labuan":       ":labuan:",
-		"Melaka":            ":melaka:",
-		"Terengganu":        ":terengganu:",
-		"W.P. Kuala Lumpur": ":kl:",
-		"Sabah":             ":sabah:",
-		"Negeri Sembilan":   ":n9:",
-		"Perak":             ":perak:",
-		"Perlis":            ":perlis:",
-		"Pahang":            ":pahang:",
-	}
-	var req []byte
+// recordText describes rec, or just state's figures in it when state is
+// set.
+func recordText(rec *model.Record, state string) string {
+	text := ""
 	if rec != nil {
-		req, _ = json.Marshal(map[string]string{
-			"text": fmt.Sprintf("%s Data as of %s\n New Cases: %d \n Import Cases: %d \n Recovered Cases: %d \n New Deaths: %d \n New Brought in Dead (BID): %d\n Actual COVID Deaths: %d \n", flags["Malaysia"], rec.Date, rec.NewCases, rec.ImportCases, rec.RecoveredCases, rec.Death.NewDeaths, rec.Death.BIDDeaths, rec.Death.ActualDeaths),
-		})
+		text = fmt.Sprintf("%s Data as of %s\n New Cases: %d \n Import Cases: %d \n Recovered Cases: %d \n New Deaths: %d \n New Brought in Dead (BID): %d\n Actual COVID Deaths: %d \n", flags["Malaysia"], rec.Date, rec.NewCases, rec.ImportCases, rec.RecoveredCases, rec.Death.NewDeaths, rec.Death.BIDDeaths, rec.Death.ActualDeaths) + metrics.Text(rec.Derived)
 	}
 
-	if state != "" {
+	if state != "" && rec != nil {
 		for k, v := range rec.States {
 			if k == state {
-				req, _ = json.Marshal(map[string]string{
-					"text": fmt.Sprintf("%s %s as of %s\n New Cases: %d \n Import Cases: %d \n Recovered Cases: %d \n New Deaths: %d \n Actual Deaths: %d", flags[k], k, rec.Date, v.NewCases, v.ImportCases, v.RecoveredCases, v.Death.NewDeaths, v.Death.ActualDeaths),
-				})
+				text = fmt.Sprintf("%s %s as of %s\n New Cases: %d \n Import Cases: %d \n Recovered Cases: %d \n New Deaths: %d \n Actual Deaths: %d", flags[k], k, rec.Date, v.NewCases, v.ImportCases, v.RecoveredCases, v.Death.NewDeaths, v.Death.ActualDeaths) + " \n" + metrics.Text(v.Derived)
 			}
 		}
 	}
 
-	if rec == nil && state == "" {
-		req, _ = json.Marshal(map[string]string{
-			"text": ":bb-say-what::bb-no-understand:",
-		})
+	if text == "" {
+		text = puzzled
 	}
-	_, _ = http.Post(os.Getenv("SLACK"), "application/json", bytes.NewBuffer(req))
+	return text
 }
 
 func NewMongoClient() (*mongo.Client, error) {
@@ -291,17 +238,21 @@ func NewMongoClient() (*mongo.Client, error) {
 	return client, nil
 }
 
-func getFromMongo(collection *mongo.Collection, date string) (*Record, error) {
-	res := &Record{}
-	opt := options.FindOne()
-	opt.SetSort(bson.M{"date": -1})
-	filter := bson.M{}
-	if date != "" {
-		filter = bson.M{"date": date}
+// getRecord returns the record for date, or the latest one when date is
+// empty, with its derived metrics filled in when the days before it load.
+func getRecord(ctx context.Context, repo repository.RecordRepository, date string) (*model.Record, error) {
+	var rec *model.Record
+	var err error
+	if date == "" {
+		rec, err = repo.Latest(ctx)
+	} else {
+		rec, err = repo.ByDate(ctx, date)
 	}
-	err := collection.FindOne(context.TODO(), filter, opt).Decode(res)
 	if err != nil {
 		return nil, err
 	}
-	return res, nil
+	if err := metrics.Load(ctx, repo, []*model.Record{rec}); err != nil {
+		log.Println("metrics:", err)
+	}
+	return rec, nil
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abx123/go-covid/dedupe"
+	"github.com/abx123/go-covid/model"
+	"github.com/abx123/go-covid/notify"
+	"github.com/abx123/go-covid/repository"
+	"github.com/abx123/go-covid/slacksig"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const testSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// recorder is a Notifier that keeps the text of every reply.
+type recorder struct {
+	texts []string
+}
+
+func (r *recorder) Notify(ctx context.Context, msg notify.Message) error {
+	r.texts = append(r.texts, msg.Text)
+	return nil
+}
+
+// event wraps body the way sns.js publishes it, signed as of at unless
+// secret is empty.
+func event(body, secret string, at time.Time) events.SNSEvent {
+	attrs := map[string]interface{}{}
+	if secret != "" {
+		for k, v := range slacksig.Headers(secret, []byte(body), at) {
+			attrs[k] = map[string]interface{}{"Type": "String", "Value": v}
+		}
+	}
+	return events.SNSEvent{Records: []events.SNSEventRecord{{SNS: events.SNSEntity{Message: body, MessageAttributes: attrs}}}}
+}
+
+func mentionEvent(id, text string) string {
+	return fmt.Sprintf(`{"type":"event_callback","event_id":%q,"event":{"type":"app_mention","channel":"C0188FC7MAP","text":"<@U0188FCRJ9H> %s"}}`, id, text)
+}
+
+func newBot(now time.Time) (*bot, *recorder) {
+	recs := []model.Record{}
+	for d := 1; d <= 20; d++ {
+		recs = append(recs, model.Record{
+			Date:     fmt.Sprintf("2021-09-%02d", d),
+			NewCases: 100 * d,
+			States:   map[string]model.State{"Selangor": {Name: "Selangor", NewCases: 10 * d}},
+		})
+	}
+	out := &recorder{}
+	clock := func() time.Time { return now }
+	return &bot{
+		repo:   repository.NewMemory(recs...),
+		out:    out,
+		seen:   dedupe.NewMemory(time.Hour, clock),
+		secret: testSecret,
+		now:    clock,
+	}, out
+}
+
+func TestBotHandle(t *testing.T) {
+	now := time.Date(2021, 9, 21, 2, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		event events.SNSEvent
+		// want is a substring of the only reply, or "" for no reply.
+		want string
+	}{
+		{"signed", event(mentionEvent("Ev1", "cobis"), testSecret, now), "Data as of 2021-09-20"},
+		{"state and date", event(mentionEvent("Ev1", "selangor 2021-09-05"), testSecret, now), "Selangor as of 2021-09-05\n New Cases: 50 "},
+		{"yesterday in MYT", event(mentionEvent("Ev1", "semalam"), testSecret, now), "Data as of 2021-09-20"},
+		{"chatter", event(mentionEvent("Ev1", "what is covid in selangor"), testSecret, now), "Selangor as of 2021-09-20"},
+		{"typo", event(mentionEvent("Ev1", "selangr"), testSecret, now), "Did you mean `selangor`?"},
+		{"typo after a command", event(mentionEvent("Ev1", "trend selangr"), testSecret, now), "Did you mean `selangor`?"},
+		{"greeting", event(`{"event_id":"Ev1","event":{"channel":"C0188FC7MAP","text":"<@U0188FCRJ9H>"}}`, testSecret, now), greeting},
+		{"other channel", event(`{"event_id":"Ev1","event":{"channel":"C0000000000","text":"cobis"}}`, testSecret, now), ""},
+		{"unsigned", event(mentionEvent("Ev1", "cobis"), "", now), ""},
+		{"wrong secret", event(mentionEvent("Ev1", "cobis"), "not-the-secret", now), ""},
+		{"replayed", event(mentionEvent("Ev1", "cobis"), testSecret, now.Add(-10*time.Minute)), ""},
+		{"url verification", event(`{"type":"url_verification","challenge":"abc"}`, testSecret, now), ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b, out := newBot(now)
+			b.handle(context.Background(), tc.event)
+			if tc.want == "" {
+				if len(out.texts) != 0 {
+					t.Errorf("replied %q, want no reply", out.texts)
+				}
+				return
+			}
+			if len(out.texts) != 1 || !strings.Contains(out.texts[0], tc.want) {
+				t.Errorf("replied %q, want one reply containing %q", out.texts, tc.want)
+			}
+		})
+	}
+}
+
+func TestBotHandleRetries(t *testing.T) {
+	now := time.Date(2021, 9, 21, 2, 0, 0, 0, time.UTC)
+	b, out := newBot(now)
+	for i := 0; i < 3; i++ {
+		b.handle(context.Background(), event(mentionEvent("Ev1", "cobis"), testSecret, now))
+	}
+	b.handle(context.Background(), event(mentionEvent("Ev2", "cobis"), testSecret, now))
+	if len(out.texts) != 2 {
+		t.Errorf("replied %d times to two distinct events", len(out.texts))
+	}
+}
@@ -7,19 +7,49 @@ const headers = {
     'x-slack-no-retry': '1',
 };
 
+// The Slack signature covers the raw body, so both headers travel to the Go
+// handler as message attributes for it to verify.
+const SIGNED_HEADERS = ['X-Slack-Signature', 'X-Slack-Request-Timestamp'];
+
+const header = (event, name) => {
+    const key = Object.keys(event.headers || {}).find(k => k.toLowerCase() === name.toLowerCase());
+    return key ? event.headers[key] : undefined;
+};
+
 exports.handler = (event) => {
     if (!event.body) {
         return Promise.resolve({ statusCode: 400, body: 'invalid', headers: headers });
     }
-    console.log("EVENT BODY", event.body)
+    const body = event.isBase64Encoded ? Buffer.from(event.body, 'base64').toString('utf8') : event.body;
+    console.log("EVENT BODY", body)
+    // Slack checks the endpoint with a url_verification request and expects
+    // the challenge echoed back in the response, so it is answered here
+    // rather than going through SNS.
+    let payload;
+    try {
+        payload = JSON.parse(body);
+    } catch (e) {
+        return Promise.resolve({ statusCode: 400, body: 'invalid', headers: headers });
+    }
+    if (payload.type === 'url_verification') {
+        return Promise.resolve({ statusCode: 200, body: JSON.stringify({ challenge: payload.challenge }), headers: headers });
+    }
+    const attributes = {};
+    SIGNED_HEADERS.forEach(name => {
+        const value = header(event, name);
+        if (value) {
+            attributes[name] = { DataType: 'String', StringValue: value };
+        }
+    });
     return sns.publish({
-        Message: event.body,
+        Message: body,
+        MessageAttributes: attributes,
         TopicArn: TOPIC_ARN
     })
         .promise()
-        .then(() => ({ statusCode: 200, body: event.body, headers: headers }))
+        .then(() => ({ statusCode: 200, body: body, headers: headers }))
         .catch(err => {
             console.log(err);
             return { statusCode: 500, body: 'sns-error', headers: headers };
         });
-};
\ No newline at end of file
+};
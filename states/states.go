@@ -0,0 +1,75 @@
+// Package states maps the many ways people write Malaysian state names onto
+// the spelling MoH uses in its datasets.
+package states
+
+import "strings"
+
+// Names are the states and federal territories as spelled by MoH.
+var Names = []string{
+	"Johor",
+	"Kedah",
+	"Kelantan",
+	"Melaka",
+	"Negeri Sembilan",
+	"Pahang",
+	"Perak",
+	"Perlis",
+	"Pulau Pinang",
+	"Sabah",
+	"Sarawak",
+	"Selangor",
+	"Terengganu",
+	"W.P. Kuala Lumpur",
+	"W.P. Labuan",
+	"W.P. Putrajaya",
+}
+
+// Aliases maps normalized nicknames to the MoH spelling. Every canonical name
+// is also accepted in its normalized form, see Normalize.
+var Aliases = map[string]string{
+	"selangor":        "Selangor",
+	"sel":             "Selangor",
+	"putrajaya":       "W.P. Putrajaya",
+	"kedah":           "Kedah",
+	"penang":          "Pulau Pinang",
+	"pulau pinang":    "Pulau Pinang",
+	"pinang":          "Pulau Pinang",
+	"sarawak":         "Sarawak",
+	"kelantan":        "Kelantan",
+	"johor":           "Johor",
+	"labuan":          "W.P. Labuan",
+	"melaka":          "Melaka",
+	"malacca":         "Melaka",
+	"terengganu":      "Terengganu",
+	"kuala lumpur":    "W.P. Kuala Lumpur",
+	"kl":              "W.P. Kuala Lumpur",
+	"sabah":           "Sabah",
+	"n9":              "Negeri Sembilan",
+	"ns":              "Negeri Sembilan",
+	"negeri sembilan": "Negeri Sembilan",
+	"perak":           "Perak",
+	"perlis":          "Perlis",
+	"pahang":          "Pahang",
+}
+
+func init() {
+	for _, n := range Names {
+		Aliases[key(n)] = n
+	}
+}
+
+// key lowercases s, drops dots, treats dashes and underscores as spaces and
+// collapses runs of whitespace, so "W.P. Kuala Lumpur", "wp-kuala-lumpur"
+// and "WP  Kuala Lumpur" all compare equal.
+func key(s string) string {
+	s = strings.ToLower(s)
+	s = strings.NewReplacer(".", "", "-", " ", "_", " ").Replace(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Normalize returns the MoH spelling of s, which may be a canonical name in
+// any case or punctuation, or one of the Aliases.
+func Normalize(s string) (string, bool) {
+	n, ok := Aliases[key(s)]
+	return n, ok
+}